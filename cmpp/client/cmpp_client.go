@@ -5,7 +5,10 @@ import (
 	"go.uber.org/zap"
 	"mock-cmpp-stress-test/cmpp/pkg"
 	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/utils/token_bucket"
+	"path"
 	"strings"
+	"sync"
 )
 
 type CmppClient struct {
@@ -22,46 +25,114 @@ func (s *CmppClient) Start() (err error) {
 	if !s.cfg.Enable {
 		return nil
 	}
+	// 按场景执行时由 connect 阶段连接
+	if config.ConfigObj.StressTest.ScenarioEnabled() {
+		return nil
+	}
+	return s.ConnectAccounts(nil)
+}
+
+// 连接指定账号（{ip}:{port}_{username}，支持通配符），keys 为空时连接全部账号
+// 已连接的跳过，任一连接失败时返回错误，连接成功的仍保留
+func (s *CmppClient) ConnectAccounts(keys []string) error {
 	errCount := 0
 
 	for _, account := range *s.cfg.Accounts {
-		cm := &pkg.CmppClientManager{}
 		addr := fmt.Sprintf("%s:%d", account.Ip, account.Port)
-
-		initErr := cm.Init(s.cfg, addr, account)
-		if initErr != nil {
-			s.Logger.Error("Cmpp Client Init Error",
-				zap.String("UserName", account.Username),
-				zap.String("Address", addr),
-				zap.Error(initErr))
-			return initErr
+		baseKey := strings.Join([]string{addr, account.Username}, "_")
+		if !matchAccount(keys, baseKey) {
+			continue
+		}
+		connections := account.Connections
+		if connections == 0 {
+			connections = 1
+		}
+		// 同一账号的所有连接共用 TPS 上限
+		var limiter *token_bucket.TokenBucket
+		if account.Tps > 0 {
+			limiter = token_bucket.New(account.Tps, account.Tps)
 		}
-		s.Logger.Info("Cmpp Client Init Success",
-			zap.String("UserName", account.Username),
-			zap.String("Address", addr))
-		err = cm.Connect()
-		if err != nil {
-			s.Logger.Error("Cmpp Client Connect Error",
+
+		for i := uint(0); i < connections; i++ {
+			// 第一个连接的 key 为 {ip}:{port}_{username}，其余连接追加 #n
+			key := baseKey
+			if i > 0 {
+				key = fmt.Sprintf("%s#%d", baseKey, i)
+			}
+			if pkg.HasClient(key) {
+				s.Logger.Info("Cmpp Client Already Connected", zap.String("Key", key))
+				continue
+			}
+			cm := &pkg.CmppClientManager{}
+			initErr := cm.Init(s.cfg, addr, account)
+			if initErr != nil {
+				s.Logger.Error("Cmpp Client Init Error",
+					zap.String("UserName", account.Username),
+					zap.String("Address", addr),
+					zap.Error(initErr))
+				return initErr
+			}
+			cm.Key = key
+			cm.Limiter = limiter
+			s.Logger.Info("Cmpp Client Init Success",
 				zap.String("UserName", account.Username),
 				zap.String("Address", addr),
-				zap.Error(err))
-			errCount += 1
-			continue
+				zap.String("Key", key))
+			if err := cm.Connect(); err != nil {
+				s.Logger.Error("Cmpp Client Connect Error",
+					zap.String("UserName", account.Username),
+					zap.String("Address", addr),
+					zap.String("Key", key),
+					zap.Error(err))
+				errCount += 1
+				continue
+			}
+			pkg.SetClient(key, cm)
 		}
-		key := strings.Join([]string{addr, account.Username}, "_")
-		pkg.Clients[key] = cm
 	}
 
-	if errCount == 0 {
-		s.Logger.Info("Cmpp Client Connect Success")
+	if errCount > 0 {
+		return fmt.Errorf("%d cmpp client connections failed", errCount)
 	}
-	return err
+	s.Logger.Info("Cmpp Client Connect Success")
+	return nil
 }
 
 func (s *CmppClient) Stop() error {
-	for _, client := range pkg.Clients {
-		client.Disconnect()
-	}
+	s.DisconnectAccounts(nil)
 	s.Logger.Info("Cmpp Client Stop Success")
 	return nil
 }
+
+// 排空并断开指定账号的所有连接，keys 为空时断开全部连接
+func (s *CmppClient) DisconnectAccounts(keys []string) {
+	// 各连接并行排空，等待未完成的响应及状态报告后再断开
+	var wg sync.WaitGroup
+	for key := range pkg.ClientsSnapshot() {
+		if !matchAccount(keys, strings.SplitN(key, "#", 2)[0]) {
+			continue
+		}
+		client, ok := pkg.RemoveClient(key)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(c *pkg.CmppClientManager) {
+			defer wg.Done()
+			c.Drain()
+		}(client)
+	}
+	wg.Wait()
+}
+
+func matchAccount(keys []string, baseKey string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, key := range keys {
+		if ok, _ := path.Match(key, baseKey); ok || key == baseKey {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,11 @@ package pkg
 
 import (
 	cmpp "github.com/bigwhite/gocmpp"
+	"go.uber.org/zap"
+	"mock-cmpp-stress-test/statistics"
+	"mock-cmpp-stress-test/utils/log"
+	"sync/atomic"
+	"time"
 )
 
 // =====================CmppClient=====================
@@ -9,16 +14,63 @@ func (cm *CmppClientManager) CmppActiveTestReq(pkg *cmpp.CmppActiveTestReqPkt) e
 	return cm.Client.SendRspPkt(&cmpp.CmppActiveTestRspPkt{}, pkg.SeqId)
 }
 
+// 收到心跳响应，按序列号计算 RTT
 func (cm *CmppClientManager) CmppActiveTestRsp(pkg *cmpp.CmppActiveTestRspPkt) error {
+	atomic.StoreInt32(&cm.activeTestNoResp, 0)
+	v, ok := cm.activeTests.LoadAndDelete(pkg.SeqId)
+	if !ok {
+		return nil
+	}
+	rtt := time.Since(v.(time.Time))
+	statistics.CollectService.Heartbeats.AddResp(rtt)
+	log.Logger.Info("[CmppClient][CmppActiveTestRsp] Success",
+		zap.String("Addr", cm.Addr),
+		zap.String("UserName", cm.UserName),
+		zap.Uint32("SeqId", pkg.SeqId),
+		zap.Duration("RTT", rtt))
 	return nil
 }
 
-// 客户端发送心跳包
+// 客户端发送心跳包，发送失败同样计为未响应
 func (cm *CmppClientManager) SendCmppActiveTestReq(pkg *cmpp.CmppActiveTestReqPkt) error {
-	_, err := cm.Client.SendReqPkt(&cmpp.CmppActiveTestReqPkt{})
+	seqId := cm.nextSeqId()
+	atomic.AddInt32(&cm.activeTestNoResp, 1)
+	// 未响应的心跳不再计算 RTT
+	cm.activeTests.Range(func(key, value interface{}) bool {
+		cm.activeTests.Delete(key)
+		statistics.CollectService.Heartbeats.AddNoResp()
+		return true
+	})
+	now := time.Now()
+	atomic.StoreInt64(&cm.lastActiveTest, now.UnixNano())
+	cm.activeTests.Store(seqId, now)
+	statistics.CollectService.Heartbeats.AddSent()
+	err := cm.Client.SendRspPkt(pkg, seqId)
+	if err != nil {
+		cm.activeTests.Delete(seqId)
+		statistics.CollectService.Heartbeats.AddNoResp()
+	}
 	return err
 }
 
+// 距最近一次收到数据包的时间
+func (cm *CmppClientManager) Idle() time.Duration {
+	last := atomic.LoadInt64(&cm.lastRecv)
+	if last == 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Since(time.Unix(0, last))
+}
+
+// 距最近一次发送心跳的时间
+func (cm *CmppClientManager) sinceActiveTest() time.Duration {
+	last := atomic.LoadInt64(&cm.lastActiveTest)
+	if last == 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Since(time.Unix(0, last))
+}
+
 // =====================CmppClient=====================
 
 // =====================CmppServer=====================
@@ -8,22 +8,78 @@ import (
 	"go.uber.org/zap"
 	_log "log"
 	"net"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	cmpp "github.com/bigwhite/gocmpp"
 	cmpputils "github.com/bigwhite/gocmpp/utils"
 	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
 	"mock-cmpp-stress-test/utils/cron_cache"
 	"mock-cmpp-stress-test/utils/log"
 )
 
-var Clients = make(map[string]*CmppClientManager)
+// 已连接的客户端，key 为 {ip}:{port}_{username}，同一账号多个连接时为 {ip}:{port}_{username}#{n}
+// 连接、断开及重连时并发修改，通过 SetClient、RemoveClient、ClientsSnapshot 访问
+var (
+	clients     = make(map[string]*CmppClientManager)
+	clientsLock sync.RWMutex
+)
+
+func SetClient(key string, cm *CmppClientManager) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	clients[key] = cm
+}
+
+func HasClient(key string) bool {
+	clientsLock.RLock()
+	defer clientsLock.RUnlock()
+	_, ok := clients[key]
+	return ok
+}
+
+// 移除 key 对应的客户端，返回被移除的客户端
+func RemoveClient(key string) (*CmppClientManager, bool) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	cm, ok := clients[key]
+	delete(clients, key)
+	return cm, ok
+}
+
+// 仅当 key 仍对应 old 时替换为 cm，重连期间连接已被断开移除时返回 false
+func replaceClient(key string, old, cm *CmppClientManager) bool {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	if clients[key] != old {
+		return false
+	}
+	clients[key] = cm
+	return true
+}
+
+// 当前客户端的副本，遍历时不阻塞连接及重连
+func ClientsSnapshot() map[string]*CmppClientManager {
+	clientsLock.RLock()
+	defer clientsLock.RUnlock()
+	snapshot := make(map[string]*CmppClientManager, len(clients))
+	for key, cm := range clients {
+		snapshot[key] = cm
+	}
+	return snapshot
+}
+
+func ClientCount() int {
+	clientsLock.RLock()
+	defer clientsLock.RUnlock()
+	return len(clients)
+}
 
 // =====================CmppClient=====================
 func (cm *CmppClientManager) Init(cfg *config.CmppClientConfig, addr string, account config.CmppAccount) error {
+	cfg = cfg.WithAccount(account)
 	v := GetVersion(cfg.Version)
 	if v == InvalidVersion {
 		return errors.New("invalid cmpp version")
@@ -34,21 +90,49 @@ func (cm *CmppClientManager) Init(cfg *config.CmppClientConfig, addr string, acc
 	cm.UserName = account.Username
 	cm.Password = account.Password
 	cm.Timeout = time.Duration(cfg.TimeOut) * time.Second
-	cm.ActiveTestInterval = time.Duration(cfg.ActiveTestInterval) * time.Millisecond
+	cm.ActiveTestInterval = time.Duration(cfg.ActiveTestInterval) * time.Second
+	cm.MaxNoRespPkgNum = cfg.MaxNoRespPkgNum
 	cm.SpId = account.SpID
 	cm.SpCode = account.SpCode
+	cm.Account = account
+	cm.DrainTimeout = time.Duration(cfg.DrainTimeout) * time.Second
+	cm.UdhRef16Bit = cfg.UdhRef16Bit
+	cm.SubmitTimeout = time.Duration(cfg.SubmitTimeout) * time.Second
+	cm.Resend = NewResendPolicy(cfg.Resend)
+	cm.DeliverRespFault = NewDeliverRespFault(cfg.DeliverResp)
+	autoReplies, err := compileAutoReplies(account.SpCode, cfg.AutoReplies)
+	if err != nil {
+		return err
+	}
+	cm.autoReplies = autoReplies
 
 	if cm.Timeout > defaultTimeout {
 		cm.Timeout = defaultTimeout
 	}
+	if cm.DrainTimeout == 0 {
+		cm.DrainTimeout = defaultDrainTimeout
+	}
+	if cm.ActiveTestInterval == 0 {
+		cm.ActiveTestInterval = defaultActiveTestInterval
+	}
+	if cm.MaxNoRespPkgNum == 0 {
+		cm.MaxNoRespPkgNum = defaultMaxNoRespPkgNum
+	}
+	if cm.SubmitTimeout == 0 {
+		cm.SubmitTimeout = defaultSubmitTimeout
+	}
 	cm.Ctx, cm.cancel = context.WithCancel(context.Background())
 	cm.Cmpp2SubmitChan = make(chan *cmpp.Cmpp2SubmitReqPkt, 500)
 	cm.Cmpp3SubmitChan = make(chan *cmpp.Cmpp3SubmitReqPkt, 500)
+	cm.terminated = make(chan struct{})
+	if account.Window > 0 {
+		cm.window = make(chan struct{}, account.Window)
+	}
 	return nil
 }
 
 func (cm *CmppClientManager) Connect() error {
-	if cm.Connected {
+	if cm.IsConnected() {
 		return nil
 	}
 	err := cm.Client.Connect(cm.Addr, cm.UserName, cm.Password, cm.Timeout)
@@ -59,21 +143,25 @@ func (cm *CmppClientManager) Connect() error {
 			zap.Error(err))
 		return err
 	}
-	cm.Connected = true
+	cm.interceptQuery()
+	cm.setConnected(true)
 	log.Logger.Info("[CmppClient][Connect] Success.", zap.String("Addr", cm.Addr), zap.String("UserName", cm.UserName), zap.String("Password", cm.Password))
 	go cm.KeepAlive()
 	go cm.StartSubmit()
 	go cm.StartClientReceive()
+	go cm.CheckSubmitTimeout()
 	return nil
 }
 
 func (cm *CmppClientManager) Disconnect() {
+	cm.setConnected(false)
 	cm.cancel()
 	cm.Client.Disconnect()
 	log.Logger.Info("[CmppClient][Disconnect] Success", zap.String("Addr", cm.Addr), zap.String("UserName", cm.UserName), zap.String("Password", cm.Password))
 }
 
 func (cm *CmppClientManager) ReceivePkg(pkg interface{}) error {
+	atomic.StoreInt64(&cm.lastRecv, time.Now().UnixNano())
 	switch p := pkg.(type) {
 	case *cmpp.CmppActiveTestReqPkt:
 		return cm.CmppActiveTestReq(p) // 收到来自服务端的心跳检测包
@@ -90,6 +178,14 @@ func (cm *CmppClientManager) ReceivePkg(pkg interface{}) error {
 	case *cmpp.Cmpp3DeliverReqPkt:
 		return cm.Cmpp3DeliverReq(p)
 
+	case *CmppQueryRspPkt:
+		return cm.CmppQueryResp(p) // 由 queryConn 拦截后交给 ReceivePkg
+
+	case *cmpp.CmppTerminateReqPkt:
+		return cm.CmppTerminateReq(p) // 服务端主动关闭连接
+	case *cmpp.CmppTerminateRspPkt:
+		return cm.CmppTerminateRsp(p)
+
 	default:
 		typeErr := errors.New("unhandled pkg type")
 		log.Logger.Error("[CmppClient][ReceivePkgs] Error",
@@ -99,10 +195,12 @@ func (cm *CmppClientManager) ReceivePkg(pkg interface{}) error {
 	return nil
 }
 
-// 客户端发送心跳检测请求
+// 客户端心跳检测：链路空闲（ActiveTestInterval 内未收到任何数据包）时发送心跳，
+// 连续 MaxNoRespPkgNum 个心跳未响应或发送失败时重连
 func (cm *CmppClientManager) KeepAlive() {
 	cm.ConnErrCount = 0
-	tk := time.NewTicker(cm.ActiveTestInterval)
+	// 按心跳间隔的 1/activeTestTicks 检查，实际间隔不超过 ActiveTestInterval 加一个检查周期
+	tk := time.NewTicker(cm.ActiveTestInterval / activeTestTicks)
 
 	defer func() {
 		if err := recover(); err != nil {
@@ -112,49 +210,118 @@ func (cm *CmppClientManager) KeepAlive() {
 	}()
 
 	for {
-		if !cm.Connected {
-			return
-		}
-
-		err := cm.SendCmppActiveTestReq(&cmpp.CmppActiveTestReqPkt{})
-		if err != nil {
-			log.Logger.Error("[CmppClient][KeepAlive] Check Alive Error", zap.Error(err), zap.String("UserName", cm.UserName))
-			cm.ConnErrCount += 1
-		} else {
-			cm.ConnErrCount = 0
-		}
-
 		select {
 		case <-tk.C:
-			if cm.ConnErrCount > 3 {
-				log.Logger.Error("[CmppClient][KeepAlive] KeepAlive Error", zap.String("UserName", cm.UserName))
-				cm.Connected = false
+			if !cm.IsConnected() {
+				return
+			}
+			sinceSent := cm.sinceActiveTest()
+			if sinceSent < cm.ActiveTestInterval {
+				continue
+			}
+			// 链路繁忙时不发送心跳，但每 activeTestSampleInterval 仍发送一次用于采样 RTT
+			if cm.Idle() < cm.ActiveTestInterval && sinceSent < activeTestSampleInterval {
+				continue
+			}
+			if noResp := atomic.LoadInt32(&cm.activeTestNoResp); noResp >= int32(cm.MaxNoRespPkgNum) {
+				log.Logger.Error("[CmppClient][KeepAlive] KeepAlive Error",
+					zap.String("UserName", cm.UserName),
+					zap.Int32("NoResp", noResp))
+				statistics.CollectService.Heartbeats.AddReconnect()
+				cm.setConnected(false)
 				go cm.Reconnect()
 				return
 			}
+			if err := cm.SendCmppActiveTestReq(&cmpp.CmppActiveTestReqPkt{}); err != nil {
+				log.Logger.Error("[CmppClient][KeepAlive] Check Alive Error", zap.Error(err), zap.String("UserName", cm.UserName))
+			}
 
 		case <-cm.Ctx.Done():
 			return
 		}
 	}
+}
+
+// 排空连接：停止接收新的提交，发送已排队的数据包，
+// 在 DrainTimeout 内等待 SubmitResp 及状态报告，最后发送 CMPP_TERMINATE 并断开连接
+func (cm *CmppClientManager) Drain() {
+	atomic.StoreInt32(&cm.draining, 1)
+	deadline := time.Now().Add(cm.DrainTimeout)
+	tk := time.NewTicker(100 * time.Millisecond)
+	defer tk.Stop()
+
+	for cm.IsConnected() && time.Now().Before(deadline) {
+		if cm.Drained() {
+			break
+		}
+		<-tk.C
+	}
+
+	queued, waitSubmitResp, waitReports := cm.PendingCount()
+	if queued > 0 || waitSubmitResp > 0 || waitReports > 0 {
+		log.Logger.Error("[CmppClient][Drain] Timeout",
+			zap.String("Addr", cm.Addr),
+			zap.String("UserName", cm.UserName),
+			zap.Int64("Queued", queued),
+			zap.Int64("WaitSubmitResp", waitSubmitResp),
+			zap.Int64("WaitReports", waitReports))
+	} else {
+		log.Logger.Info("[CmppClient][Drain] Success",
+			zap.String("Addr", cm.Addr),
+			zap.String("UserName", cm.UserName))
+	}
+
+	if cm.IsConnected() {
+		if err := cm.Terminate(); err != nil {
+			log.Logger.Error("[CmppClient][Terminate] Error",
+				zap.String("Addr", cm.Addr),
+				zap.String("UserName", cm.UserName),
+				zap.Error(err))
+		}
+	}
+	cm.Disconnect()
+}
+
+// 是否已无排队、待响应的提交包及待接收的状态报告
+func (cm *CmppClientManager) Drained() bool {
+	queued, waitSubmitResp, waitReports := cm.PendingCount()
+	return queued <= 0 && waitSubmitResp <= 0 && waitReports <= 0
+}
+
+func (cm *CmppClientManager) PendingCount() (queued, waitSubmitResp, waitReports int64) {
+	return atomic.LoadInt64(&cm.queued), atomic.LoadInt64(&cm.waitSubmitResp), atomic.LoadInt64(&cm.waitReports)
+}
+
+func (cm *CmppClientManager) IsConnected() bool {
+	return atomic.LoadInt32(&cm.connected) == 1
+}
+
+func (cm *CmppClientManager) setConnected(connected bool) {
+	var v int32
+	if connected {
+		v = 1
+	}
+	atomic.StoreInt32(&cm.connected, v)
+}
 
+func (cm *CmppClientManager) IsDraining() bool {
+	return atomic.LoadInt32(&cm.draining) == 1
+}
+
+// 所有请求包共用的序列号，CMPP_CONNECT 之后的请求包不再使用 gocmpp 连接自带的序列号
+func (cm *CmppClientManager) nextSeqId() uint32 {
+	return atomic.AddUint32(&cm.seqId, 1)
 }
 
 func (cm *CmppClientManager) Reconnect() {
+	if cm.IsDraining() {
+		return
+	}
 	cm.cancel()
 	time.Sleep(100 * time.Millisecond)
 
 	ncm := &CmppClientManager{}
-	addrArr := strings.Split(cm.Addr, ":")
-	port, _ := strconv.Atoi(addrArr[1])
-	naccount := config.CmppAccount{
-		Username: cm.UserName,
-		Password: cm.Password,
-		Ip:       addrArr[0],
-		Port:     uint16(port),
-		SpID:     cm.SpId,
-		SpCode:   cm.SpCode,
-	}
+	naccount := cm.Account
 
 	initErr := ncm.Init(config.ConfigObj.ClientConfig, cm.Addr, naccount)
 	if initErr != nil {
@@ -162,6 +329,7 @@ func (cm *CmppClientManager) Reconnect() {
 			zap.String("UserName", naccount.Username),
 			zap.String("Address", cm.Addr),
 			zap.Error(initErr))
+		cm.settle(nil)
 		return
 	}
 	log.Logger.Info("Cmpp Client Reconnect Init Success",
@@ -174,7 +342,8 @@ func (cm *CmppClientManager) Reconnect() {
 			zap.String("UserName", ncm.UserName),
 			zap.String("Address", ncm.Addr),
 			zap.Error(err))
-		ncm.Connected = false
+		ncm.setConnected(false)
+		cm.settle(nil)
 		return
 	}
 
@@ -182,8 +351,16 @@ func (cm *CmppClientManager) Reconnect() {
 		zap.String("UserName", ncm.UserName),
 		zap.String("Address", ncm.Addr))
 
-	key := strings.Join([]string{ncm.Addr, ncm.UserName}, "_")
-	Clients[key] = ncm
+	ncm.Key = cm.Key
+	ncm.Limiter = cm.Limiter
+	cm.settle(ncm)
+	if !replaceClient(ncm.Key, cm, ncm) {
+		log.Logger.Info("Cmpp Client Reconnect Removed",
+			zap.String("UserName", ncm.UserName),
+			zap.String("Address", ncm.Addr),
+			zap.String("Key", ncm.Key))
+		ncm.Disconnect()
+	}
 }
 
 func (cm *CmppClientManager) StartSubmit() {
@@ -203,7 +380,7 @@ func (cm *CmppClientManager) StartSubmit() {
 	}()
 
 	for {
-		if !cm.Connected {
+		if !cm.IsConnected() {
 			return
 		}
 
@@ -250,7 +427,7 @@ func (cm *CmppClientManager) StartClientReceive() {
 					zap.String("UserName", cm.UserName),
 					zap.String("Address", cm.Addr),
 					zap.Int("errCount", errCount))
-				cm.Connected = false
+				cm.setConnected(false)
 				go cm.Reconnect()
 				return
 			}
@@ -409,8 +586,10 @@ func (sm *CmppServerManager) Connect(req *cmpp.Packet, res *cmpp.Response) (bool
 		}
 	}
 
+	conn := &Conn{UserName: account.UserName, password: account.Password, spCode: account.SpCode, spId: account.SpId}
 	sm.ConnMap.Store(addr, req)
-	sm.UserMap.Store(addr, &Conn{UserName: account.UserName, password: account.Password, spCode: account.SpCode, spId: account.SpId})
+	sm.UserMap.Store(addr, conn)
+	sm.interceptQuery(req, conn)
 
 	log.Logger.Info("[CmppServer][Login] Success",
 		zap.String("UserName", pkg.SrcAddr),
@@ -453,3 +632,48 @@ func (sm *CmppServerManager) Stop() {
 }
 
 // =====================CmppServer=====================
+
+// 重连时结算旧连接的计数，避免排空及等待状态报告时一直等待已断开的连接：
+// 通道中未发送的提交包记为发送失败，等待 SubmitResp 的提交包不会再收到响应，记为超时失败；
+// 重连成功时待接收的状态报告数转入新连接，网关可能在新连接上推送状态报告
+func (cm *CmppClientManager) settle(ncm *CmppClientManager) {
+	var dropped int64
+	for drained := false; !drained; {
+		select {
+		case <-cm.Cmpp2SubmitChan:
+			dropped++
+		case <-cm.Cmpp3SubmitChan:
+			dropped++
+		default:
+			drained = true
+		}
+	}
+	atomic.AddInt64(&cm.queued, -dropped)
+	for i := int64(0); i < dropped; i++ {
+		statistics.CollectService.Service.AddPackerStatistics("Client", "Submit", false)
+	}
+
+	var timeout int64
+	cm.pendingSubmits.Range(func(key, value interface{}) bool {
+		if _, ok := cm.pendingSubmits.LoadAndDelete(key); ok {
+			timeout++
+			atomic.AddUint64(&cm.feedback.Timeout, 1)
+			statistics.CollectService.Submits.AddTimeout()
+			statistics.CollectService.Submits.AddFailed()
+			cm.submitDone()
+		}
+		return true
+	})
+
+	var moved int64
+	if ncm != nil {
+		moved = atomic.SwapInt64(&cm.waitReports, 0)
+		atomic.AddInt64(&ncm.waitReports, moved)
+	}
+	log.Logger.Info("[CmppClient][Reconnect] Settle",
+		zap.String("Addr", cm.Addr),
+		zap.String("UserName", cm.UserName),
+		zap.Int64("Dropped", dropped),
+		zap.Int64("Timeout", timeout),
+		zap.Int64("MovedReports", moved))
+}
@@ -9,40 +9,75 @@ import (
 	"mock-cmpp-stress-test/utils/buf"
 	"mock-cmpp-stress-test/utils/log"
 	"runtime"
+	"sync/atomic"
 	"time"
 )
 
 // =====================CmppClient=====================
 
 func (cm *CmppClientManager) Cmpp2DeliverReq(pkg *cmpp.Cmpp2DeliverReqPkt) error {
+	fault := cm.DeliverRespFault.Decide()
+	// 拒绝或不响应的 Deliver 等待网关重发，不计入状态报告、上行统计
+	if fault.Accepted() {
+		if pkg.RegisterDelivery == 1 {
+			report := &Cmpp2StatsReportMsgContent{}
+			if err := report.Decode(pkg.MsgContent); err != nil {
+				log.Logger.Error("[CmppClient][Cmpp2DeliverReq] Decode Report Error",
+					zap.String("Addr", cm.Addr),
+					zap.String("UserName", cm.UserName),
+					zap.Uint64("MsgId", pkg.MsgId),
+					zap.Error(err))
+			} else {
+				cm.reportReceived(report.MsgId, report.DestTerminalId, report.Stat)
+			}
+		} else {
+			cm.moReceived(pkg.MsgId, pkg.SrcTerminalId, pkg.DestId, pkg.MsgFmt, pkg.TpUdhi, pkg.MsgContent)
+		}
+	}
 	log.Logger.Info("[CmppClient][Cmpp2DeliverReq] Success",
 		zap.String("Addr", cm.Addr),
 		zap.String("UserName", cm.UserName),
 		zap.Any("Pkg", pkg))
-
 	statistics.CollectService.Service.AddPackerStatistics("Client", "Deliver", true)
-	statistics.CollectService.Service.AddPackerStatistics("Client", "DeliverResp", true)
-	return cm.Client.SendRspPkt(&cmpp.Cmpp2DeliverRspPkt{
+	return cm.sendDeliverResp(&cmpp.Cmpp2DeliverRspPkt{
 		MsgId:  pkg.MsgId,
-		Result: 0,
-	}, pkg.SeqId)
+		Result: uint8(fault.Result),
+	}, pkg.SeqId, pkg.MsgId, fault)
 }
 
 func (cm *CmppClientManager) Cmpp3DeliverReq(pkg *cmpp.Cmpp3DeliverReqPkt) error {
+	fault := cm.DeliverRespFault.Decide()
+	// 拒绝或不响应的 Deliver 等待网关重发，不计入状态报告、上行统计
+	if fault.Accepted() {
+		if pkg.RegisterDelivery == 1 {
+			report := &Cmpp3StatsReportMsgContent{}
+			if err := report.Decode(pkg.MsgContent); err != nil {
+				log.Logger.Error("[CmppClient][Cmpp3DeliverReq] Decode Report Error",
+					zap.String("Addr", cm.Addr),
+					zap.String("UserName", cm.UserName),
+					zap.Uint64("MsgId", pkg.MsgId),
+					zap.Error(err))
+			} else {
+				cm.reportReceived(report.MsgId, report.DestTerminalId, report.Stat)
+			}
+		} else {
+			cm.moReceived(pkg.MsgId, pkg.SrcTerminalId, pkg.DestId, pkg.MsgFmt, pkg.TpUdhi, pkg.MsgContent)
+		}
+	}
 	log.Logger.Info("[CmppClient][Cmpp3DeliverReq] Success",
 		zap.String("Addr", cm.Addr),
 		zap.String("UserName", cm.UserName),
 		zap.Any("Pkg", pkg))
 	statistics.CollectService.Service.AddPackerStatistics("Client", "Deliver", true)
-	statistics.CollectService.Service.AddPackerStatistics("Client", "DeliverResp", true)
-	return cm.Client.SendRspPkt(&cmpp.Cmpp3DeliverRspPkt{
+	return cm.sendDeliverResp(&cmpp.Cmpp3DeliverRspPkt{
 		MsgId:  pkg.MsgId,
-		Result: 0,
-	}, pkg.SeqId)
+		Result: uint32(fault.Result),
+	}, pkg.SeqId, pkg.MsgId, fault)
 }
 
 func (cm *CmppClientManager) BatchCmpp2Submit(pkgs []*cmpp.Cmpp2SubmitReqPkt) {
-	if !cm.Connected {
+	if !cm.IsConnected() {
+		atomic.AddInt64(&cm.queued, -int64(len(pkgs)))
 		return
 	}
 	for _, each := range pkgs {
@@ -51,15 +86,22 @@ func (cm *CmppClientManager) BatchCmpp2Submit(pkgs []*cmpp.Cmpp2SubmitReqPkt) {
 }
 
 func (cm *CmppClientManager) Cmpp2SubmitPkg(pkg *cmpp.Cmpp2SubmitReqPkt) {
-	if !cm.Connected {
+	defer atomic.AddInt64(&cm.queued, -1)
+	if !cm.IsConnected() {
+		statistics.CollectService.Service.AddPackerStatistics("Client", "Submit", false)
+		return
+	}
+	if !cm.acquireSubmit() {
 		statistics.CollectService.Service.AddPackerStatistics("Client", "Submit", false)
 		return
 	}
 	// 让出 CPU 资源
 	runtime.Gosched()
-	seqId, sendErr := cm.Client.SendReqPkt(pkg)
+	seqId := cm.submitSent(pkg, pkg.RegisteredDelivery, pkg.DestTerminalId)
+	sendErr := cm.Client.SendRspPkt(pkg, seqId)
 	phone := pkg.DestTerminalId[0]
 	if sendErr != nil {
+		cm.submitSendFailed(seqId)
 		cm.ConnErrCount += 1
 		log.Logger.Error("[CmppClient][Cmpp2Submit] Error",
 			zap.String("Addr", cm.Addr),
@@ -89,14 +131,21 @@ func (cm *CmppClientManager) BatchCmpp3Submit(pkgs []*cmpp.Cmpp3SubmitReqPkt) {
 }
 
 func (cm *CmppClientManager) Cmpp3SubmitPkg(pkg *cmpp.Cmpp3SubmitReqPkt) {
-	if !cm.Connected {
+	defer atomic.AddInt64(&cm.queued, -1)
+	if !cm.IsConnected() {
+		statistics.CollectService.Service.AddPackerStatistics("Client", "Submit", false)
+		return
+	}
+	if !cm.acquireSubmit() {
 		statistics.CollectService.Service.AddPackerStatistics("Client", "Submit", false)
 		return
 	}
 	// 让出 CPU 资源
 	runtime.Gosched()
-	seqId, sendErr := cm.Client.SendReqPkt(pkg)
+	seqId := cm.submitSent(pkg, pkg.RegisteredDelivery, pkg.DestTerminalId)
+	sendErr := cm.Client.SendRspPkt(pkg, seqId)
 	if sendErr != nil {
+		cm.submitSendFailed(seqId)
 		cm.ConnErrCount += 1
 		log.Logger.Error("[CmppClient][Cmpp3Submit] Error", zap.Error(sendErr))
 		statistics.CollectService.Service.AddPackerStatistics("Client", "Submit", false)
@@ -131,28 +180,38 @@ var Cmpp2DeliverChan = make(chan *MockCmpp2DeliverPkg, 500)
 var Cmpp3DeliverChan = make(chan *MockCmpp3DeliverPkg, 500)
 
 func (sm *CmppServerManager) MockCmpp2Deliver(addr, spCode string, msgId uint64, pkg *cmpp.Cmpp2SubmitReqPkt) {
-	// 构造一个回执
-	stat := "DELIVRD"
-	deliverPkg := &cmpp.Cmpp2DeliverReqPkt{
-		MsgId:            msgId,
-		DestId:           spCode,
-		ServiceId:        "",
-		TpPid:            0,
-		TpUdhi:           0,
-		MsgFmt:           0,
-		SrcTerminalId:    pkg.DestTerminalId[0],
-		RegisterDelivery: 1,
-		Reserve:          "",
+	behavior := currentServerBehavior()
+	if behavior.ReportDelay > 0 {
+		time.Sleep(behavior.ReportDelay)
 	}
-	submitTime := time.Unix(time.Now().Unix(), 0).Format("0601021504")
-	doneTime := submitTime
-	msgContent := formatReportMsgContent("V20", msgId, stat, submitTime, doneTime, deliverPkg.SrcTerminalId, uint32(1))
+	// 群发时每个号码各返回一个回执，MsgId 相同
+	for _, phone := range pkg.DestTerminalId {
+		if behavior.dropReport() {
+			continue
+		}
+		// 构造一个回执
+		stat := behavior.ReportStat
+		deliverPkg := &cmpp.Cmpp2DeliverReqPkt{
+			MsgId:            msgId,
+			DestId:           spCode,
+			ServiceId:        "",
+			TpPid:            0,
+			TpUdhi:           0,
+			MsgFmt:           0,
+			SrcTerminalId:    phone,
+			RegisterDelivery: 1,
+			Reserve:          "",
+		}
+		submitTime := time.Unix(time.Now().Unix(), 0).Format("0601021504")
+		doneTime := submitTime
+		msgContent := formatReportMsgContent("V20", msgId, stat, submitTime, doneTime, deliverPkg.SrcTerminalId, uint32(1))
 
-	deliverPkg.MsgContent = msgContent
-	deliverPkg.MsgLength = uint8(len(msgContent))
+		deliverPkg.MsgContent = msgContent
+		deliverPkg.MsgLength = uint8(len(msgContent))
 
-	// 返回状态报告
-	sm.SendCmpp2DeliverPkg(deliverPkg, addr)
+		// 返回状态报告
+		sm.SendCmpp2DeliverPkg(deliverPkg, addr)
+	}
 }
 
 func (sm *CmppServerManager) SendCmpp2DeliverPkg(pkg *cmpp.Cmpp2DeliverReqPkt, addr string) {
@@ -169,27 +228,37 @@ func (sm *CmppServerManager) BatchCmpp2Deliver(pkgs []*MockCmpp2DeliverPkg) {
 }
 
 func (sm *CmppServerManager) MockCmpp3Deliver(addr, spCode string, msgId uint64, pkg *cmpp.Cmpp3SubmitReqPkt) {
-	// 构造一个回执
-	stat := "DELIVRD"
-	deliverPkg := &cmpp.Cmpp3DeliverReqPkt{
-		MsgId:            msgId,
-		DestId:           spCode,
-		ServiceId:        "",
-		TpPid:            0,
-		TpUdhi:           0,
-		MsgFmt:           0,
-		SrcTerminalId:    pkg.DestTerminalId[0],
-		RegisterDelivery: 1,
+	behavior := currentServerBehavior()
+	if behavior.ReportDelay > 0 {
+		time.Sleep(behavior.ReportDelay)
 	}
-	submitTime := time.Unix(time.Now().Unix(), 0).Format("0601021504")
-	doneTime := submitTime
-	msgContent := formatReportMsgContent("V30", msgId, stat, submitTime, doneTime, deliverPkg.SrcTerminalId, uint32(1))
+	// 群发时每个号码各返回一个回执，MsgId 相同
+	for _, phone := range pkg.DestTerminalId {
+		if behavior.dropReport() {
+			continue
+		}
+		// 构造一个回执
+		stat := behavior.ReportStat
+		deliverPkg := &cmpp.Cmpp3DeliverReqPkt{
+			MsgId:            msgId,
+			DestId:           spCode,
+			ServiceId:        "",
+			TpPid:            0,
+			TpUdhi:           0,
+			MsgFmt:           0,
+			SrcTerminalId:    phone,
+			RegisterDelivery: 1,
+		}
+		submitTime := time.Unix(time.Now().Unix(), 0).Format("0601021504")
+		doneTime := submitTime
+		msgContent := formatReportMsgContent("V30", msgId, stat, submitTime, doneTime, deliverPkg.SrcTerminalId, uint32(1))
 
-	deliverPkg.MsgContent = msgContent
-	deliverPkg.MsgLength = uint8(len([]rune(msgContent)))
+		deliverPkg.MsgContent = msgContent
+		deliverPkg.MsgLength = uint8(len([]rune(msgContent)))
 
-	// 返回状态报告
-	go sm.SendCmpp3DeliverPkg(deliverPkg, addr)
+		// 返回状态报告
+		go sm.SendCmpp3DeliverPkg(deliverPkg, addr)
+	}
 }
 
 func (sm *CmppServerManager) SendCmpp3DeliverPkg(pkg *cmpp.Cmpp3DeliverReqPkt, addr string) {
@@ -296,6 +365,17 @@ type Cmpp3StatsReportMsgContent struct {
 	SmscSequence   uint32
 }
 
+func (p *Cmpp2StatsReportMsgContent) Decode(content string) error {
+	r := buf.NewBufReader([]byte(content))
+	r.ReadInt(&p.MsgId, binary.BigEndian)
+	p.Stat = string(r.ReadOctetString(7))
+	p.SubmitTime = string(r.ReadOctetString(10))
+	p.DoneTime = string(r.ReadOctetString(10))
+	p.DestTerminalId = string(r.ReadOctetString(21))
+	r.ReadInt(&p.SmscSequence, binary.BigEndian)
+	return r.Error()
+}
+
 func (p *Cmpp2StatsReportMsgContent) Encode() (string, error) {
 	var pkgLen uint32 = 8 + 7 + 10 + 10 + 21 + 4
 
@@ -315,6 +395,17 @@ func (p *Cmpp2StatsReportMsgContent) Encode() (string, error) {
 	return string(b), nil
 }
 
+func (p *Cmpp3StatsReportMsgContent) Decode(content string) error {
+	r := buf.NewBufReader([]byte(content))
+	r.ReadInt(&p.MsgId, binary.BigEndian)
+	p.Stat = string(r.ReadOctetString(7))
+	p.SubmitTime = string(r.ReadOctetString(10))
+	p.DoneTime = string(r.ReadOctetString(10))
+	p.DestTerminalId = string(r.ReadOctetString(32))
+	r.ReadInt(&p.SmscSequence, binary.BigEndian)
+	return r.Error()
+}
+
 func (p *Cmpp3StatsReportMsgContent) Encode() (string, error) {
 	var pkgLen uint32 = 8 + 7 + 10 + 10 + 21 + 4
 
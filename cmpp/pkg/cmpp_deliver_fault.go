@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"math/rand"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"mock-cmpp-stress-test/utils/log"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+	"go.uber.org/zap"
+)
+
+// DeliverResp 默认注入的错误码：9 其他错误
+const defaultDeliverRespErrorCode = 9
+
+// 客户端 DeliverResp 故障注入，用于测试网关的状态报告重发逻辑
+type DeliverRespFault struct {
+	ErrorRate  float64
+	ErrorCodes []uint32
+	DelayRate  float64
+	DelayMin   time.Duration
+	DelayMax   time.Duration
+	DropRate   float64
+}
+
+// 单个 Deliver 的响应方式
+type DeliverRespAction struct {
+	Drop   bool          // 不响应
+	Result uint32        // 响应错误码
+	Delay  time.Duration // 延迟响应
+}
+
+func (a DeliverRespAction) Accepted() bool {
+	return !a.Drop && a.Result == 0
+}
+
+// 未配置时返回 nil，始终立即以 Result 0 响应
+func NewDeliverRespFault(cfg *config.DeliverRespFaultConfig) *DeliverRespFault {
+	if cfg == nil {
+		return nil
+	}
+	f := &DeliverRespFault{
+		ErrorRate:  cfg.ErrorRate,
+		ErrorCodes: cfg.ErrorCodes,
+		DelayRate:  cfg.DelayRate,
+		DelayMin:   time.Duration(cfg.DelayMin) * time.Millisecond,
+		DelayMax:   time.Duration(cfg.DelayMax) * time.Millisecond,
+		DropRate:   cfg.DropRate,
+	}
+	if len(f.ErrorCodes) == 0 {
+		f.ErrorCodes = []uint32{defaultDeliverRespErrorCode}
+	}
+	if f.DelayMax < f.DelayMin {
+		f.DelayMax = f.DelayMin
+	}
+	return f
+}
+
+// 按配置的比例决定响应方式，不响应、错误码、延迟依次判断，错误码可与延迟同时生效
+func (f *DeliverRespFault) Decide() DeliverRespAction {
+	var a DeliverRespAction
+	if f == nil {
+		return a
+	}
+	if f.DropRate > 0 && rand.Float64() < f.DropRate {
+		a.Drop = true
+		return a
+	}
+	if f.ErrorRate > 0 && rand.Float64() < f.ErrorRate {
+		a.Result = f.ErrorCodes[rand.Intn(len(f.ErrorCodes))]
+	}
+	if f.DelayRate > 0 && rand.Float64() < f.DelayRate {
+		a.Delay = f.DelayMin
+		if f.DelayMax > f.DelayMin {
+			a.Delay += time.Duration(rand.Int63n(int64(f.DelayMax - f.DelayMin)))
+		}
+	}
+	return a
+}
+
+// 按故障注入结果发送 DeliverResp
+func (cm *CmppClientManager) sendDeliverResp(rsp cmpp.Packer, seqId uint32, msgId uint64, fault DeliverRespAction) error {
+	if fault.Drop {
+		log.Logger.Info("[CmppClient][DeliverResp] Drop",
+			zap.String("UserName", cm.UserName),
+			zap.Uint64("MsgId", msgId),
+			zap.Uint32("SeqId", seqId))
+		statistics.CollectService.Service.AddPackerStatistics("Client", "DeliverResp", false)
+		return nil
+	}
+	statistics.CollectService.Service.AddPackerStatistics("Client", "DeliverResp", fault.Result == 0)
+	if fault.Result != 0 {
+		log.Logger.Info("[CmppClient][DeliverResp] Inject Error",
+			zap.String("UserName", cm.UserName),
+			zap.Uint64("MsgId", msgId),
+			zap.Uint32("Result", fault.Result),
+			zap.Duration("Delay", fault.Delay))
+	}
+	if fault.Delay <= 0 {
+		return cm.Client.SendRspPkt(rsp, seqId)
+	}
+	// 延迟响应不阻塞接收
+	time.AfterFunc(fault.Delay, func() {
+		if !cm.IsConnected() {
+			return
+		}
+		if err := cm.Client.SendRspPkt(rsp, seqId); err != nil {
+			log.Logger.Error("[CmppClient][DeliverResp] Delay Send Error",
+				zap.String("UserName", cm.UserName),
+				zap.Uint64("MsgId", msgId),
+				zap.Error(err))
+		}
+	})
+	return nil
+}
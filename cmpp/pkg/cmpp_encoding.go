@@ -0,0 +1,220 @@
+package pkg
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	cmpputils "github.com/bigwhite/gocmpp/utils"
+)
+
+// 短信内容编码，对应 Submit 中的 MsgFmt
+const (
+	MsgFmtASCII  uint8 = 0
+	MsgFmtBinary uint8 = 4
+	MsgFmtUCS2   uint8 = 8
+	MsgFmtGBK    uint8 = 15
+)
+
+const (
+	EncodingAuto   = "auto"
+	EncodingASCII  = "ascii"
+	EncodingBinary = "binary"
+	EncodingUCS2   = "ucs2"
+	EncodingGBK    = "gbk"
+)
+
+// 不同编码的长度限制，单位字节
+// ASCII 单条 160 个字符，长短信每条 153 个字符；其余编码单条 140 字节，长短信每条 134 字节（去掉 6 字节 UDH）
+type MsgEncoding struct {
+	Name    string
+	MsgFmt  uint8
+	Single  int // 单条短信内容最大字节数
+	Segment int // 长短信每条内容最大字节数（不含 UDH）
+}
+
+var msgEncodings = map[string]*MsgEncoding{
+	EncodingASCII:  {Name: EncodingASCII, MsgFmt: MsgFmtASCII, Single: 160, Segment: 153},
+	EncodingBinary: {Name: EncodingBinary, MsgFmt: MsgFmtBinary, Single: 140, Segment: 134},
+	EncodingUCS2:   {Name: EncodingUCS2, MsgFmt: MsgFmtUCS2, Single: 140, Segment: 134},
+	EncodingGBK:    {Name: EncodingGBK, MsgFmt: MsgFmtGBK, Single: 140, Segment: 134},
+}
+
+// 编码别名，gbk 编码实际按 GB18030 转换
+var msgEncodingAliases = map[string]string{
+	"gb18030": EncodingGBK,
+}
+
+var ErrInvalidEncoding = errors.New("invalid message encoding")
+
+// 按名称（不区分大小写）或别名获取编码
+func GetMsgEncoding(name string) (*MsgEncoding, error) {
+	name = strings.ToLower(name)
+	if alias, ok := msgEncodingAliases[name]; ok {
+		name = alias
+	}
+	if e, ok := msgEncodings[name]; ok {
+		return e, nil
+	}
+	return nil, ErrInvalidEncoding
+}
+
+// 按编码将短信内容转换为编码单元，每个单元为一个字符编码后的字节，拆分长短信时不会拆开单元
+// binary 编码时 content 为十六进制字符串，每个字节为一个单元
+func EncodeContent(content, encoding string) (*MsgEncoding, [][]byte, error) {
+	if encoding == "" || strings.ToLower(encoding) == EncodingAuto {
+		return autoEncodeContent(content)
+	}
+
+	enc, err := GetMsgEncoding(encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+	units, err := encodeUnits(content, enc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, units, nil
+}
+
+// 自动选择分段数最少的编码：纯 ASCII 使用 ASCII，否则在 UCS2 与 GBK 中选择，分段数相同时优先 UCS2
+func autoEncodeContent(content string) (*MsgEncoding, [][]byte, error) {
+	if isASCII(content) {
+		enc := msgEncodings[EncodingASCII]
+		units, err := encodeUnits(content, enc)
+		return enc, units, err
+	}
+
+	enc := msgEncodings[EncodingUCS2]
+	units, err := encodeUnits(content, enc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gbk := msgEncodings[EncodingGBK]
+	gbkUnits, gbkErr := encodeUnits(content, gbk)
+	if gbkErr == nil && SegmentCount(gbkUnits, gbk, false) < SegmentCount(units, enc, false) {
+		return gbk, gbkUnits, nil
+	}
+	return enc, units, nil
+}
+
+func encodeUnits(content string, enc *MsgEncoding) ([][]byte, error) {
+	switch enc.MsgFmt {
+	case MsgFmtBinary:
+		data, err := hex.DecodeString(content)
+		if err != nil {
+			return nil, err
+		}
+		units := make([][]byte, len(data))
+		for i := range data {
+			units[i] = data[i : i+1]
+		}
+		return units, nil
+
+	case MsgFmtASCII:
+		if !isASCII(content) {
+			return nil, errors.New("content is not ascii")
+		}
+		units := make([][]byte, len(content))
+		for i := 0; i < len(content); i++ {
+			units[i] = []byte{content[i]}
+		}
+		return units, nil
+	}
+
+	if !utf8.ValidString(content) {
+		return nil, errors.New("content is not valid utf8")
+	}
+
+	units := make([][]byte, 0, len(content))
+	for _, r := range content {
+		var (
+			s   string
+			err error
+		)
+		if enc.MsgFmt == MsgFmtGBK {
+			s, err = cmpputils.Utf8ToGB18030(string(r))
+		} else {
+			s, err = cmpputils.Utf8ToUcs2(string(r))
+		}
+		if err != nil {
+			return nil, err
+		}
+		units = append(units, []byte(s))
+	}
+	return units, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// 编码后内容的总字节数
+func unitsLength(units [][]byte) int {
+	length := 0
+	for _, u := range units {
+		length += len(u)
+	}
+	return length
+}
+
+// 按编码长度限制计算分段数，udhRef16Bit 时每条长短信可用长度少 1 字节，与 SplitLongSms 拆分结果一致
+func SegmentCount(units [][]byte, enc *MsgEncoding, udhRef16Bit bool) int {
+	if unitsLength(units) <= enc.Single {
+		return 1
+	}
+	return len(packUnits(units, segmentSize(enc, udhRef16Bit)))
+}
+
+// 长短信每条内容最大字节数（不含 UDH）
+func segmentSize(enc *MsgEncoding, udhRef16Bit bool) int {
+	if udhRef16Bit {
+		return enc.Segment - (udhLength16BitRef - udhLength8BitRef)
+	}
+	return enc.Segment
+}
+
+// 将编码单元依次装入不超过 size 字节的分段
+func packUnits(units [][]byte, size int) [][]byte {
+	segments := make([][]byte, 0)
+	segment := make([]byte, 0, size)
+	for _, u := range units {
+		if len(segment)+len(u) > size {
+			segments = append(segments, segment)
+			segment = make([]byte, 0, size)
+		}
+		segment = append(segment, u...)
+	}
+	if len(segment) > 0 {
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// 按 MsgFmt 将 Deliver 中的短信内容解码为 UTF-8，tpUdhi 为 1 时去掉 UDH
+// binary 内容返回十六进制字符串，未知编码按 ASCII 处理
+func DecodeContent(content string, msgFmt, tpUdhi uint8) (string, error) {
+	if tpUdhi == 1 && len(content) > 0 {
+		udhLength := int(content[0]) + 1
+		if udhLength > len(content) {
+			return "", errors.New("invalid udh length")
+		}
+		content = content[udhLength:]
+	}
+	switch msgFmt {
+	case MsgFmtUCS2:
+		return cmpputils.Ucs2ToUtf8(content)
+	case MsgFmtGBK:
+		return cmpputils.GB18030ToUtf8(content)
+	case MsgFmtBinary:
+		return hex.EncodeToString([]byte(content)), nil
+	}
+	return content, nil
+}
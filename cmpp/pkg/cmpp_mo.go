@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"fmt"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"mock-cmpp-stress-test/utils/log"
+	"mock-cmpp-stress-test/utils/msg_template"
+	"regexp"
+	"strings"
+
+	cmpp "github.com/bigwhite/gocmpp"
+	"go.uber.org/zap"
+)
+
+// 上行短信自动回复规则
+type autoReplyRule struct {
+	keyword string
+	match   string
+	re      *regexp.Regexp
+	content *msg_template.Template
+	extend  string
+}
+
+// 自动回复以 sp_code + extend 作为 SrcId，超过 21 字节时返回错误
+func compileAutoReplies(spCode string, cfgs *[]config.AutoReply) ([]*autoReplyRule, error) {
+	if cfgs == nil {
+		return nil, nil
+	}
+	rules := make([]*autoReplyRule, 0, len(*cfgs))
+	for _, c := range *cfgs {
+		if err := CheckDestId(spCode, c.Extend); err != nil {
+			return nil, fmt.Errorf("invalid auto reply extend: %w", err)
+		}
+		rule := &autoReplyRule{keyword: c.Keyword, match: strings.ToLower(c.Match), extend: c.Extend}
+		switch rule.match {
+		case "":
+			rule.match = "contains"
+		case "contains", "prefix", "exact":
+		case "regex":
+			re, err := regexp.Compile(c.Keyword)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auto reply regex %s: %s", c.Keyword, err.Error())
+			}
+			rule.re = re
+		default:
+			return nil, fmt.Errorf("invalid auto reply match: %s", c.Match)
+		}
+		content, err := msg_template.Compile(c.Content)
+		if err != nil {
+			return nil, err
+		}
+		rule.content = content
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *autoReplyRule) Match(content string) bool {
+	content = strings.TrimSpace(content)
+	switch r.match {
+	case "prefix":
+		return strings.HasPrefix(content, r.keyword)
+	case "exact":
+		return content == r.keyword
+	case "regex":
+		return r.re.MatchString(content)
+	}
+	return strings.Contains(content, r.keyword)
+}
+
+// 收到上行短信：解码内容并记录，匹配自动回复规则时向发送号码回复短信
+func (cm *CmppClientManager) moReceived(msgId uint64, srcTerminalId, destId string, msgFmt, tpUdhi uint8, msgContent string) {
+	statistics.CollectService.Mos.AddReceived()
+	content, err := DecodeContent(msgContent, msgFmt, tpUdhi)
+	if err != nil {
+		log.Logger.Error("[CmppClient][Mo] Decode Error",
+			zap.String("Addr", cm.Addr),
+			zap.String("UserName", cm.UserName),
+			zap.Uint64("MsgId", msgId),
+			zap.Uint8("MsgFmt", msgFmt),
+			zap.Error(err))
+		return
+	}
+	log.Logger.Info("[CmppClient][Mo] Received",
+		zap.String("Addr", cm.Addr),
+		zap.String("UserName", cm.UserName),
+		zap.Uint64("MsgId", msgId),
+		zap.String("Phone", srcTerminalId),
+		zap.String("DestId", destId),
+		zap.String("Content", content))
+
+	for _, rule := range cm.autoReplies {
+		if !rule.Match(content) {
+			continue
+		}
+		message := &config.TextMessages{
+			Phone:  srcTerminalId,
+			Extend: rule.extend,
+			Content: rule.content.Render(&msg_template.Context{
+				Account:   cm.UserName,
+				MoPhone:   srcTerminalId,
+				MoContent: content,
+			}),
+		}
+		statistics.CollectService.Mos.AddReplied()
+		log.Logger.Info("[CmppClient][Mo] Auto Reply",
+			zap.String("UserName", cm.UserName),
+			zap.String("Phone", srcTerminalId),
+			zap.String("Keyword", rule.keyword),
+			zap.String("Content", message.Content))
+		// 在接收协程外发送，避免阻塞接收
+		if cm.Version == cmpp.V30 {
+			go cm.Cmpp3Submit(message)
+		} else {
+			go cm.Cmpp2Submit(message)
+		}
+		return
+	}
+}
@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mock-cmpp-stress-test/utils/log"
+	"sync/atomic"
+
+	cmpp "github.com/bigwhite/gocmpp"
+	"go.uber.org/zap"
+)
+
+// 上行短信 DestId 为 sp_code + 扩展码，最长 21 字节
+const maxDestIdLen = 21
+
+var (
+	ErrMoTooLong     = errors.New("mo content exceeds single message length")
+	ErrMoNoConnected = errors.New("no connection of the username")
+	ErrDestIdTooLong = errors.New("sp_code + extend exceeds 21 bytes")
+)
+
+// 校验 sp_code 拼接扩展码后不超过 21 字节，超出时协议字段会被截断
+func CheckDestId(spCode, extend string) error {
+	if len(spCode)+len(extend) > maxDestIdLen {
+		return fmt.Errorf("%w: %s + %s", ErrDestIdTooLong, spCode, extend)
+	}
+	return nil
+}
+
+// 向每个已登录的客户端连接推送一条模拟上行短信
+func (sm *CmppServerManager) MockMo(phone, content, extend string) {
+	if _, err := sm.mockMo("", phone, content, extend); err != nil {
+		log.Logger.Error("[CmppServer][MockMo] Error",
+			zap.String("Phone", phone),
+			zap.String("Content", content),
+			zap.Error(err))
+	}
+}
+
+// 向用户名为 username 的一个已登录连接推送一条模拟上行短信
+func (sm *CmppServerManager) MockMoTo(username, phone, content, extend string) error {
+	sent, err := sm.mockMo(username, phone, content, extend)
+	if err != nil {
+		return err
+	}
+	if sent == 0 {
+		return ErrMoNoConnected
+	}
+	return nil
+}
+
+// username 为空时推送至所有连接，否则只推送至该用户名的第一个连接，返回推送的连接数
+func (sm *CmppServerManager) mockMo(username, phone, content, extend string) (int, error) {
+	enc, units, err := EncodeContent(content, EncodingAuto)
+	if err == nil && unitsLength(units) > enc.Single {
+		err = ErrMoTooLong
+	}
+	if err != nil {
+		return 0, err
+	}
+	msgContent := string(bytes.Join(units, nil))
+
+	sent := 0
+	sm.UserMap.Range(func(key, value interface{}) bool {
+		addr := key.(string)
+		account := value.(*Conn)
+		if username != "" && account.UserName != username {
+			return true
+		}
+		// 该连接账号的 sp_code 拼接扩展码超长时不推送
+		if destErr := CheckDestId(account.spCode, extend); destErr != nil {
+			err = destErr
+			return username == ""
+		}
+		msgId, err := GetMsgId(account.spId, <-sm.SubmitSeqId)
+		if err != nil {
+			log.Logger.Error("[CmppServer][MockMo] GetMsgId Error",
+				zap.String("SpId", account.spId),
+				zap.Error(err))
+			return true
+		}
+
+		if sm.Version == cmpp.V30 {
+			sm.SendCmpp3DeliverPkg(&cmpp.Cmpp3DeliverReqPkt{
+				MsgId:            msgId,
+				DestId:           account.spCode + extend,
+				MsgFmt:           enc.MsgFmt,
+				SrcTerminalId:    phone,
+				RegisterDelivery: 0,
+				MsgLength:        uint8(len(msgContent)),
+				MsgContent:       msgContent,
+			}, addr)
+		} else {
+			sm.SendCmpp2DeliverPkg(&cmpp.Cmpp2DeliverReqPkt{
+				MsgId:            msgId,
+				DestId:           account.spCode + extend,
+				MsgFmt:           enc.MsgFmt,
+				SrcTerminalId:    phone,
+				RegisterDelivery: 0,
+				MsgLength:        uint8(len(msgContent)),
+				MsgContent:       msgContent,
+			}, addr)
+		}
+		log.Logger.Info("[CmppServer][MockMo] Success",
+			zap.String("Addr", addr),
+			zap.String("UserName", account.UserName),
+			zap.Uint64("MsgId", msgId),
+			zap.String("Phone", phone),
+			zap.String("Content", content))
+		sent++
+		atomic.AddUint64(&account.moScs, 1)
+		return username == ""
+	})
+	return sent, err
+}
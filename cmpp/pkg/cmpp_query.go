@@ -0,0 +1,354 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	cmpp "github.com/bigwhite/gocmpp"
+	"go.uber.org/zap"
+	"mock-cmpp-stress-test/utils/buf"
+	"mock-cmpp-stress-test/utils/log"
+)
+
+// =====================CmppQuery=====================
+// gocmpp 只定义了 CMPP_QUERY 的命令字，没有对应的数据包，收到时返回 ErrCommandIdNotSupported 并丢弃包体，
+// 服务端还会因此断开连接；这里实现查询请求及响应的数据包，并在 net.Conn 层拦截这两种数据包，
+// 其余数据包原样交给 gocmpp 解包。CMPP2.0 与 CMPP3.0 的查询数据包格式相同
+
+const (
+	cmppHeaderLen       = 12
+	cmppQueryReqBodyLen = 8 + 1 + 10 + 8
+	cmppQueryRspBodyLen = 8 + 1 + 10 + 4*8
+	cmppQueryReqLen     = cmppHeaderLen + cmppQueryReqBodyLen
+	cmppQueryRspLen     = cmppHeaderLen + cmppQueryRspBodyLen
+)
+
+// 查询请求业务代码的最大长度
+const MaxQueryCodeLen = 10
+
+var ErrQueryPktLength = errors.New("cmpp query packet length is invalid")
+
+// 查询请求，QueryType 为 0 时查询总数，为 1 时按业务代码 QueryCode 查询
+type CmppQueryReqPkt struct {
+	Time      string // YYYYMMDD
+	QueryType uint8
+	QueryCode string
+	Reserve   string
+
+	// session info
+	SeqId uint32
+}
+
+// 查询响应，各计数为当日累计值
+type CmppQueryRspPkt struct {
+	Time      string
+	QueryType uint8
+	QueryCode string
+	MtTlMsg   uint32 // 从 SP 接收的信息总数
+	MtTlUsr   uint32 // 从 SP 接收的用户总数
+	MtScs     uint32 // 成功转发数量
+	MtWt      uint32 // 待转发数量
+	MtFl      uint32 // 转发失败数量
+	MoScs     uint32 // 向 SP 成功送达数量
+	MoWt      uint32 // 向 SP 待送达数量
+	MoFl      uint32 // 向 SP 送达失败数量
+
+	// session info
+	SeqId uint32
+}
+
+func (p *CmppQueryReqPkt) Pack(seqId uint32) ([]byte, error) {
+	w := buf.NewBufWriter(cmppQueryReqLen)
+	w.WriteInt(uint32(cmppQueryReqLen), 0, binary.BigEndian)
+	w.WriteInt(cmpp.CMPP_QUERY, 0, binary.BigEndian)
+	w.WriteInt(seqId, 0, binary.BigEndian)
+	p.SeqId = seqId
+
+	w.WriteFixedSizeString(p.Time, 8)
+	w.WriteInt(p.QueryType, 0, binary.BigEndian)
+	w.WriteFixedSizeString(p.QueryCode, MaxQueryCodeLen)
+	w.WriteFixedSizeString(p.Reserve, 8)
+	return w.Bytes()
+}
+
+// data 从序列号开始，与 gocmpp 数据包的 Unpack 相同
+func (p *CmppQueryReqPkt) Unpack(data []byte) error {
+	if len(data) != cmppQueryReqLen-8 {
+		return ErrQueryPktLength
+	}
+	r := buf.NewBufReader(data)
+	r.ReadInt(&p.SeqId, binary.BigEndian)
+	p.Time = string(r.ReadOctetString(8))
+	r.ReadInt(&p.QueryType, binary.BigEndian)
+	p.QueryCode = string(r.ReadOctetString(MaxQueryCodeLen))
+	p.Reserve = string(r.ReadOctetString(8))
+	return r.Error()
+}
+
+func (p *CmppQueryRspPkt) Pack(seqId uint32) ([]byte, error) {
+	w := buf.NewBufWriter(cmppQueryRspLen)
+	w.WriteInt(uint32(cmppQueryRspLen), 0, binary.BigEndian)
+	w.WriteInt(cmpp.CMPP_QUERY_RESP, 0, binary.BigEndian)
+	w.WriteInt(seqId, 0, binary.BigEndian)
+	p.SeqId = seqId
+
+	w.WriteFixedSizeString(p.Time, 8)
+	w.WriteInt(p.QueryType, 0, binary.BigEndian)
+	w.WriteFixedSizeString(p.QueryCode, MaxQueryCodeLen)
+	for _, v := range []uint32{p.MtTlMsg, p.MtTlUsr, p.MtScs, p.MtWt, p.MtFl, p.MoScs, p.MoWt, p.MoFl} {
+		w.WriteInt(v, 0, binary.BigEndian)
+	}
+	return w.Bytes()
+}
+
+func (p *CmppQueryRspPkt) Unpack(data []byte) error {
+	if len(data) != cmppQueryRspLen-8 {
+		return ErrQueryPktLength
+	}
+	r := buf.NewBufReader(data)
+	r.ReadInt(&p.SeqId, binary.BigEndian)
+	p.Time = string(r.ReadOctetString(8))
+	r.ReadInt(&p.QueryType, binary.BigEndian)
+	p.QueryCode = string(r.ReadOctetString(MaxQueryCodeLen))
+	for _, v := range []*uint32{&p.MtTlMsg, &p.MtTlUsr, &p.MtScs, &p.MtWt, &p.MtFl, &p.MoScs, &p.MoWt, &p.MoFl} {
+		r.ReadInt(v, binary.BigEndian)
+	}
+	return r.Error()
+}
+
+// 拦截查询数据包的连接：按 Total_Length 切分数据流，CMPP_QUERY、CMPP_QUERY_RESP 解包后交给 handle，
+// 其余数据包的字节原样返回给 gocmpp；读超时时保留已读取的部分，下次读取时继续
+type queryConn struct {
+	net.Conn
+	handle func(pkt cmpp.Packer)
+
+	header [8]byte // Total_Length + Command_Id
+	n      int     // 已读取的 header 字节数
+	body   []byte  // 拦截的数据包从序列号开始的内容
+	m      int     // 已读取的 body 字节数
+	out    []byte  // 待返回给 gocmpp 的 header
+	pass   int     // 当前数据包待返回给 gocmpp 的剩余字节数
+}
+
+func newQueryConn(conn net.Conn, handle func(pkt cmpp.Packer)) *queryConn {
+	return &queryConn{Conn: conn, handle: handle}
+}
+
+func (c *queryConn) Read(b []byte) (int, error) {
+	for {
+		if len(c.out) > 0 {
+			n := copy(b, c.out)
+			c.out = c.out[n:]
+			return n, nil
+		}
+		if c.pass > 0 {
+			if len(b) > c.pass {
+				b = b[:c.pass]
+			}
+			n, err := c.Conn.Read(b)
+			c.pass -= n
+			return n, err
+		}
+		if c.body != nil {
+			n, err := c.Conn.Read(c.body[c.m:])
+			c.m += n
+			if c.m < len(c.body) {
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+			c.dispatch()
+			continue
+		}
+
+		n, err := c.Conn.Read(c.header[c.n:])
+		c.n += n
+		if c.n < len(c.header) {
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		c.n = 0
+		totalLen := binary.BigEndian.Uint32(c.header[0:4])
+		commandId := cmpp.CommandId(binary.BigEndian.Uint32(c.header[4:8]))
+		if (commandId == cmpp.CMPP_QUERY && totalLen == cmppQueryReqLen) ||
+			(commandId == cmpp.CMPP_QUERY_RESP && totalLen == cmppQueryRspLen) {
+			c.body = make([]byte, totalLen-8)
+			c.m = 0
+			continue
+		}
+		c.out = append(c.out[:0], c.header[:]...)
+		if totalLen > 8 {
+			c.pass = int(totalLen) - 8
+		}
+	}
+}
+
+func (c *queryConn) dispatch() {
+	commandId := cmpp.CommandId(binary.BigEndian.Uint32(c.header[4:8]))
+	body := c.body
+	c.body = nil
+
+	var pkt cmpp.Packer
+	if commandId == cmpp.CMPP_QUERY {
+		pkt = &CmppQueryReqPkt{}
+	} else {
+		pkt = &CmppQueryRspPkt{}
+	}
+	if err := pkt.Unpack(body); err != nil {
+		log.Logger.Error("[CmppQuery][Unpack] Error",
+			zap.String("RemoteAddr", c.RemoteAddr().String()),
+			zap.Error(err))
+		return
+	}
+	c.handle(pkt)
+}
+
+// gocmpp 未导出 Client 的连接，通过反射取得后替换其底层 net.Conn
+// 依赖 go.mod 固定的 gocmpp 版本中 Client.conn 为 *Conn，字段不存在或类型变化时返回 nil
+func clientConn(c *cmpp.Client) *cmpp.Conn {
+	v := reflect.ValueOf(c).Elem().FieldByName("conn")
+	if !v.IsValid() || v.Type() != reflect.TypeOf((*cmpp.Conn)(nil)) {
+		return nil
+	}
+	return (*cmpp.Conn)(unsafe.Pointer(v.Pointer()))
+}
+
+// =====================CmppQuery=====================
+
+// =====================CmppClient=====================
+
+// 连接成功后拦截查询响应，需在启动收发协程前调用
+func (cm *CmppClientManager) interceptQuery() {
+	conn := clientConn(cm.Client)
+	if conn == nil {
+		log.Logger.Warn("[CmppClient][InterceptQuery] Error: can't find gocmpp client conn, query resp will be dropped",
+			zap.String("Addr", cm.Addr),
+			zap.String("UserName", cm.UserName))
+		return
+	}
+	conn.Conn = newQueryConn(conn.Conn, func(pkt cmpp.Packer) {
+		if err := cm.ReceivePkg(pkt); err != nil {
+			log.Logger.Error("[CmppClient][QueryResp] Error",
+				zap.String("Addr", cm.Addr),
+				zap.String("UserName", cm.UserName),
+				zap.Error(err))
+		}
+	})
+}
+
+// 发送查询请求，queryCode 为空时查询总数，否则按业务代码查询
+func (cm *CmppClientManager) SendCmppQueryReq(queryCode string) error {
+	pkt := &CmppQueryReqPkt{
+		Time:      time.Now().Format("20060102"),
+		QueryCode: queryCode,
+	}
+	if queryCode != "" {
+		pkt.QueryType = 1
+	}
+	seqId := cm.nextSeqId()
+	cm.queries.Store(seqId, time.Now())
+	if err := cm.Client.SendRspPkt(pkt, seqId); err != nil {
+		cm.queries.Delete(seqId)
+		log.Logger.Error("[CmppClient][Query] Error",
+			zap.String("Addr", cm.Addr),
+			zap.String("UserName", cm.UserName),
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (cm *CmppClientManager) CmppQueryResp(pkg *CmppQueryRspPkt) error {
+	v, ok := cm.queries.LoadAndDelete(pkg.SeqId)
+	if !ok {
+		log.Logger.Warn("[CmppClient][QueryResp] Unmatched",
+			zap.String("Addr", cm.Addr),
+			zap.String("UserName", cm.UserName),
+			zap.Uint32("SeqId", pkg.SeqId))
+		return nil
+	}
+	log.Logger.Info("[CmppClient][QueryResp] Success",
+		zap.String("Addr", cm.Addr),
+		zap.String("UserName", cm.UserName),
+		zap.Uint32("SeqId", pkg.SeqId),
+		zap.Duration("RTT", time.Since(v.(time.Time))),
+		zap.Uint32("MtTlMsg", pkg.MtTlMsg),
+		zap.Uint32("MtScs", pkg.MtScs),
+		zap.Uint32("MtFl", pkg.MtFl),
+		zap.Uint32("MoScs", pkg.MoScs))
+	return nil
+}
+
+// 移除超过 SubmitTimeout 未响应的查询
+func (cm *CmppClientManager) expireQueries(now time.Time) {
+	cm.queries.Range(func(key, value interface{}) bool {
+		if now.Sub(value.(time.Time)) < cm.SubmitTimeout {
+			return true
+		}
+		cm.queries.Delete(key)
+		log.Logger.Warn("[CmppClient][QueryTimeout]",
+			zap.String("Addr", cm.Addr),
+			zap.String("UserName", cm.UserName),
+			zap.Uint32("SeqId", key.(uint32)))
+		return true
+	})
+}
+
+// =====================CmppClient=====================
+
+// =====================CmppServer=====================
+
+// 登录成功后拦截该连接的查询请求，按连接的累计值响应
+func (sm *CmppServerManager) interceptQuery(req *cmpp.Packet, account *Conn) {
+	conn := req.Conn
+	conn.Conn = newQueryConn(conn.Conn, func(pkt cmpp.Packer) {
+		if p, ok := pkt.(*CmppQueryReqPkt); ok {
+			sm.CmppQueryReq(conn, account, p)
+		}
+	})
+}
+
+// 记录连接收到的提交包及处理结果
+func (c *Conn) addSubmit(destinations int, success bool) {
+	atomic.AddUint64(&c.mtMsg, 1)
+	atomic.AddUint64(&c.mtUsr, uint64(destinations))
+	if success {
+		atomic.AddUint64(&c.mtScs, 1)
+	} else {
+		atomic.AddUint64(&c.mtFl, 1)
+	}
+}
+
+func (sm *CmppServerManager) CmppQueryReq(conn *cmpp.Conn, account *Conn, pkg *CmppQueryReqPkt) {
+	resp := &CmppQueryRspPkt{
+		Time:      pkg.Time,
+		QueryType: pkg.QueryType,
+		QueryCode: pkg.QueryCode,
+		MtTlMsg:   uint32(atomic.LoadUint64(&account.mtMsg)),
+		MtTlUsr:   uint32(atomic.LoadUint64(&account.mtUsr)),
+		MtScs:     uint32(atomic.LoadUint64(&account.mtScs)),
+		MtFl:      uint32(atomic.LoadUint64(&account.mtFl)),
+		MoScs:     uint32(atomic.LoadUint64(&account.moScs)),
+	}
+	if err := conn.SendPkt(resp, pkg.SeqId); err != nil {
+		log.Logger.Error("[CmppServer][QueryResp] Error",
+			zap.String("UserName", account.UserName),
+			zap.Error(err))
+		return
+	}
+	log.Logger.Info("[CmppServer][Query] Success",
+		zap.String("UserName", account.UserName),
+		zap.Uint8("QueryType", pkg.QueryType),
+		zap.String("QueryCode", pkg.QueryCode),
+		zap.Uint32("SeqId", pkg.SeqId))
+}
+
+// =====================CmppServer=====================
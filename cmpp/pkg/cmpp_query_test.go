@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+
+	cmpp "github.com/bigwhite/gocmpp"
+)
+
+// 升级 gocmpp 后 Client.conn 字段变化时 clientConn 无法拦截查询响应
+func TestClientConnField(t *testing.T) {
+	f, ok := reflect.TypeOf(cmpp.Client{}).FieldByName("conn")
+	if !ok || f.Type != reflect.TypeOf((*cmpp.Conn)(nil)) {
+		t.Fatalf("gocmpp Client.conn field changed: %v", f.Type)
+	}
+	conn := &cmpp.Conn{}
+	c := cmpp.NewClient(cmpp.V30)
+	reflect.NewAt(f.Type, unsafe.Pointer(uintptr(unsafe.Pointer(c))+f.Offset)).Elem().Set(reflect.ValueOf(conn))
+	if got := clientConn(c); got != conn {
+		t.Fatalf("clientConn = %p, want %p", got, conn)
+	}
+}
+
+func TestCmppQueryReqPktPackUnpack(t *testing.T) {
+	req := &CmppQueryReqPkt{Time: "20260101", QueryType: 1, QueryCode: "TEST"}
+	data, err := req.Pack(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != cmppQueryReqLen {
+		t.Fatalf("length = %d, want %d", len(data), cmppQueryReqLen)
+	}
+
+	got := &CmppQueryReqPkt{}
+	if err := got.Unpack(data[8:]); err != nil {
+		t.Fatal(err)
+	}
+	if got.SeqId != 7 || got.Time != req.Time || got.QueryType != req.QueryType || trimNul(got.QueryCode) != req.QueryCode {
+		t.Fatalf("unpack = %+v, want %+v", got, req)
+	}
+	if err := got.Unpack(data[9:]); err != ErrQueryPktLength {
+		t.Fatalf("short packet err = %v, want %v", err, ErrQueryPktLength)
+	}
+}
+
+func TestCmppQueryRspPktPackUnpack(t *testing.T) {
+	rsp := &CmppQueryRspPkt{
+		Time: "20260101", QueryType: 1, QueryCode: "TEST",
+		MtTlMsg: 1, MtTlUsr: 2, MtScs: 3, MtWt: 4, MtFl: 5, MoScs: 6, MoWt: 7, MoFl: 8,
+	}
+	data, err := rsp.Pack(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != cmppQueryRspLen {
+		t.Fatalf("length = %d, want %d", len(data), cmppQueryRspLen)
+	}
+
+	got := &CmppQueryRspPkt{}
+	if err := got.Unpack(data[8:]); err != nil {
+		t.Fatal(err)
+	}
+	got.QueryCode = trimNul(got.QueryCode)
+	if !reflect.DeepEqual(got, rsp) {
+		t.Fatalf("unpack = %+v, want %+v", got, rsp)
+	}
+}
+
+func trimNul(s string) string {
+	return string(bytes.TrimRight([]byte(s), "\x00"))
+}
+
+// 按 sizes 循环切分每次读取的字节数，模拟 TCP 分段
+type chunkConn struct {
+	net.Conn
+	data  []byte
+	sizes []int
+	i     int
+}
+
+func (c *chunkConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *chunkConn) Read(b []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	n := c.sizes[c.i%len(c.sizes)]
+	c.i++
+	if n > len(b) {
+		n = len(b)
+	}
+	if n > len(c.data) {
+		n = len(c.data)
+	}
+	copy(b, c.data[:n])
+	c.data = c.data[n:]
+	return n, nil
+}
+
+// 混合查询与其他数据包的字节流，返回完整字节流、去掉查询数据包后的字节流及查询数据包数
+func queryTestStream(t *testing.T) ([]byte, []byte, int) {
+	packets := []cmpp.Packer{
+		&cmpp.CmppActiveTestReqPkt{},
+		&CmppQueryReqPkt{Time: "20260101"},
+		&cmpp.Cmpp3SubmitRspPkt{MsgId: 1, Result: 0},
+		&CmppQueryRspPkt{Time: "20260101", MtTlMsg: 10},
+		&CmppQueryRspPkt{Time: "20260101", MtTlMsg: 11},
+		&cmpp.Cmpp3DeliverReqPkt{MsgId: 2, DestId: "1069", SrcTerminalId: "13900000000", MsgLength: 5, MsgContent: "hello"},
+		&cmpp.CmppActiveTestRspPkt{},
+		&CmppQueryReqPkt{Time: "20260101", QueryType: 1, QueryCode: "CODE"},
+	}
+	var all, rest []byte
+	queries := 0
+	for i, p := range packets {
+		data, err := p.Pack(uint32(i + 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, data...)
+		switch p.(type) {
+		case *CmppQueryReqPkt, *CmppQueryRspPkt:
+			queries++
+		default:
+			rest = append(rest, data...)
+		}
+	}
+	return all, rest, queries
+}
+
+func TestQueryConnPassthrough(t *testing.T) {
+	all, rest, queries := queryTestStream(t)
+	for _, sizes := range [][]int{{len(all)}, {1}, {3, 5, 7}, {4, 13, 2, 40}} {
+		for _, bufSize := range []int{1, 4, 8, 64, 4096} {
+			var handled int
+			c := newQueryConn(&chunkConn{data: all, sizes: sizes}, func(pkt cmpp.Packer) { handled++ })
+
+			var out []byte
+			b := make([]byte, bufSize)
+			for {
+				n, err := c.Read(b)
+				out = append(out, b[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(out, rest) {
+				t.Fatalf("sizes %v buf %d: passthrough bytes changed", sizes, bufSize)
+			}
+			if handled != queries {
+				t.Fatalf("sizes %v buf %d: handled %d queries, want %d", sizes, bufSize, handled, queries)
+			}
+		}
+	}
+}
+
+func TestQueryConnRecvAndUnpackPkt(t *testing.T) {
+	all, _, queries := queryTestStream(t)
+	var handled []cmpp.Packer
+	qc := newQueryConn(&chunkConn{data: all, sizes: []int{3, 1, 9}}, func(pkt cmpp.Packer) { handled = append(handled, pkt) })
+	conn := &cmpp.Conn{Conn: qc, State: cmpp.CONN_CONNECTED, Typ: cmpp.V30}
+
+	var got []interface{}
+	for {
+		p, err := conn.RecvAndUnpackPkt(0)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+	if len(got) != 4 || len(handled) != queries {
+		t.Fatalf("got %d packets and %d queries, want 4 and %d", len(got), len(handled), queries)
+	}
+	if d, ok := got[2].(*cmpp.Cmpp3DeliverReqPkt); !ok || d.MsgId != 2 || d.MsgContent != "hello" {
+		t.Fatalf("deliver = %+v", got[2])
+	}
+	if r, ok := handled[1].(*CmppQueryRspPkt); !ok || r.MtTlMsg != 10 || r.SeqId != 4 {
+		t.Fatalf("query resp = %+v", handled[1])
+	}
+}
@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	cmpp "github.com/bigwhite/gocmpp"
+	"go.uber.org/zap"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"mock-cmpp-stress-test/utils/log"
+	"sync/atomic"
+	"time"
+)
+
+// 未配置重发时只发送一次
+func NewResendPolicy(cfg *config.ResendConfig) ResendPolicy {
+	p := ResendPolicy{
+		MaxAttempts:  1,
+		RetryResults: make(map[uint32]bool),
+	}
+	if cfg == nil {
+		return p
+	}
+	if cfg.MaxAttempts > 1 {
+		p.MaxAttempts = cfg.MaxAttempts
+	}
+	for _, r := range cfg.RetryResults {
+		p.RetryResults[r] = true
+	}
+	p.Interval = time.Duration(cfg.Interval) * time.Millisecond
+	return p
+}
+
+// 定时检查等待 SubmitResp 超时的提交包，按重发策略重发，否则记为失败；同时移除超时未响应的查询
+func (cm *CmppClientManager) CheckSubmitTimeout() {
+	tk := time.NewTicker(500 * time.Millisecond)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-tk.C:
+			now := time.Now()
+			cm.expireQueries(now)
+			cm.pendingSubmits.Range(func(key, value interface{}) bool {
+				record := value.(*SubmitRecord)
+				if now.Sub(record.SendTime) < cm.SubmitTimeout {
+					return true
+				}
+				if _, ok := cm.pendingSubmits.LoadAndDelete(key); !ok {
+					return true
+				}
+				statistics.CollectService.Submits.AddTimeout()
+				atomic.AddUint64(&cm.feedback.Timeout, 1)
+				log.Logger.Warn("[CmppClient][SubmitTimeout]",
+					zap.String("Addr", cm.Addr),
+					zap.String("UserName", cm.UserName),
+					zap.Uint32("SeqId", key.(uint32)),
+					zap.Uint("Attempts", record.Attempts))
+				if !cm.resendSubmit(record, "Timeout") {
+					cm.submitDone()
+					statistics.CollectService.Submits.AddFailed()
+				}
+				return true
+			})
+		case <-cm.Ctx.Done():
+			return
+		}
+	}
+}
+
+// 未达最大发送次数时，间隔 Interval 后使用新序列号重发，返回是否重发
+// 重发前后提交包始终计入 waitSubmitResp，排空时会等待重发结果
+func (cm *CmppClientManager) resendSubmit(record *SubmitRecord, reason string) bool {
+	if record.Attempts >= cm.Resend.MaxAttempts {
+		return false
+	}
+	record.Attempts++
+	statistics.CollectService.Submits.AddResend()
+
+	send := func() {
+		seqId := cm.storeSubmit(record)
+		var err error
+		if !cm.IsConnected() {
+			err = cmpp.ErrConnIsClosed
+		} else if cm.Limiter != nil && cm.Limiter.Wait(cm.Ctx) != nil {
+			err = cmpp.ErrConnIsClosed
+		} else {
+			err = cm.Client.SendRspPkt(record.Pkt, seqId)
+		}
+		if err != nil {
+			cm.submitSendFailed(seqId)
+			statistics.CollectService.Submits.AddFailed()
+			log.Logger.Error("[CmppClient][Resend] Error",
+				zap.String("Addr", cm.Addr),
+				zap.String("UserName", cm.UserName),
+				zap.String("Reason", reason),
+				zap.Uint("Attempts", record.Attempts),
+				zap.Error(err))
+			return
+		}
+		log.Logger.Info("[CmppClient][Resend] Success",
+			zap.String("Addr", cm.Addr),
+			zap.String("UserName", cm.UserName),
+			zap.String("Reason", reason),
+			zap.Strings("Phones", record.DestTerminalIds),
+			zap.Uint32("SeqId", seqId),
+			zap.Uint("Attempts", record.Attempts))
+	}
+	if cm.Resend.Interval > 0 {
+		time.AfterFunc(cm.Resend.Interval, send)
+	} else {
+		go send()
+	}
+	return true
+}
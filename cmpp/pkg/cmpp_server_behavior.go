@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"math/rand"
+	"mock-cmpp-stress-test/config"
+	"sync/atomic"
+	"time"
+)
+
+const defaultReportStat = "DELIVRD"
+
+// 服务端模拟行为，运行中可通过 SetServerBehavior 替换
+type ServerBehavior struct {
+	SubmitResult    uint32
+	SubmitErrorRate float64
+	SubmitDelay     time.Duration
+	ReportStat      string
+	ReportDropRate  float64
+	ReportDelay     time.Duration
+}
+
+var serverBehavior atomic.Value // *ServerBehavior
+
+// 替换服务端模拟行为，cfg 为 nil 时恢复默认行为
+func SetServerBehavior(cfg *config.ServerBehavior) *ServerBehavior {
+	b := &ServerBehavior{
+		SubmitResult: SubmitResultFlowControl,
+		ReportStat:   defaultReportStat,
+	}
+	if cfg != nil {
+		b.SubmitErrorRate = cfg.SubmitErrorRate
+		b.SubmitDelay = time.Duration(cfg.SubmitDelay) * time.Millisecond
+		b.ReportDropRate = cfg.ReportDropRate
+		b.ReportDelay = time.Duration(cfg.ReportDelay) * time.Millisecond
+		if cfg.SubmitResult != 0 {
+			b.SubmitResult = cfg.SubmitResult
+		}
+		if cfg.ReportStat != "" {
+			b.ReportStat = cfg.ReportStat
+		}
+	}
+	serverBehavior.Store(b)
+	return b
+}
+
+func currentServerBehavior() *ServerBehavior {
+	if b, ok := serverBehavior.Load().(*ServerBehavior); ok {
+		return b
+	}
+	return SetServerBehavior(nil)
+}
+
+// 延迟 SubmitResp 后按比例返回注入的错误码，0 表示正常处理
+func (b *ServerBehavior) submitResult() uint32 {
+	if b.SubmitDelay > 0 {
+		time.Sleep(b.SubmitDelay)
+	}
+	if b.SubmitErrorRate > 0 && rand.Float64() < b.SubmitErrorRate {
+		return b.SubmitResult
+	}
+	return 0
+}
+
+// 按比例丢弃回执
+func (b *ServerBehavior) dropReport() bool {
+	return b.ReportDropRate > 0 && rand.Float64() < b.ReportDropRate
+}
@@ -1,17 +1,17 @@
 package pkg
 
 import (
+	"errors"
 	"fmt"
 	cmpp "github.com/bigwhite/gocmpp"
-	cmpputils "github.com/bigwhite/gocmpp/utils"
 	"go.uber.org/zap"
-	"math"
 	"mock-cmpp-stress-test/config"
 	"mock-cmpp-stress-test/statistics"
 	"mock-cmpp-stress-test/utils/log"
 	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,12 +20,25 @@ import (
 
 func (cm *CmppClientManager) GetCmppSubmit2ReqPkg(message *config.TextMessages) ([]*cmpp.Cmpp2SubmitReqPkt, error) {
 	packets := make([]*cmpp.Cmpp2SubmitReqPkt, 0)
-	content, err := cmpputils.Utf8ToUcs2(message.Content)
+	destTerminalIds, err := DestTerminalIds(message)
 	if err != nil {
 		return nil, err
 	}
 
-	chunks := cm.SplitLongSms(content)
+	enc, units, err := EncodeContent(message.Content, message.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := cm.ResolveSubmitFields(message)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := cm.SplitLongSms(units, enc)
+	if err != nil {
+		return nil, err
+	}
 	var tpUdhi uint8
 	if len(chunks) > 1 {
 		tpUdhi = 1
@@ -40,21 +53,22 @@ func (cm *CmppClientManager) GetCmppSubmit2ReqPkg(message *config.TextMessages)
 		p := &cmpp.Cmpp2SubmitReqPkt{
 			PkTotal:            uint8(len(chunks)),
 			PkNumber:           uint8(i + 1),
-			RegisteredDelivery: 1,
-			MsgLevel:           1,
-			ServiceId:          cm.SpId,
-			FeeUserType:        2,
+			RegisteredDelivery: fields.RegisteredDelivery,
+			MsgLevel:           fields.MsgLevel,
+			ServiceId:          fields.ServiceId,
+			FeeUserType:        fields.FeeUserType,
+			FeeTerminalId:      fields.FeeTerminalId,
+			TpPid:              fields.TpPid,
 			TpUdhi:             tpUdhi,
-			FeeTerminalId:      message.Phone,
-			MsgFmt:             8,
-			MsgSrc:             cm.SpId,
-			FeeType:            "02",
-			FeeCode:            "10",
-			ValidTime:          "151105131555101+",
-			AtTime:             "",
+			MsgFmt:             enc.MsgFmt,
+			MsgSrc:             fields.MsgSrc,
+			FeeType:            fields.FeeType,
+			FeeCode:            fields.FeeCode,
+			ValidTime:          fields.ValidTime,
+			AtTime:             fields.AtTime,
 			SrcId:              srcId,
-			DestUsrTl:          1,
-			DestTerminalId:     []string{message.Phone},
+			DestUsrTl:          uint8(len(destTerminalIds)),
+			DestTerminalId:     destTerminalIds,
 			MsgLength:          uint8(len(chunk)),
 			MsgContent:         string(chunk),
 		}
@@ -64,24 +78,36 @@ func (cm *CmppClientManager) GetCmppSubmit2ReqPkg(message *config.TextMessages)
 	return packets, nil
 }
 
-func (cm *CmppClientManager) Cmpp2Submit(message *config.TextMessages) {
+// 生成并发送提交包，生成失败或连接排空中时返回错误
+func (cm *CmppClientManager) Cmpp2Submit(message *config.TextMessages) error {
 	pkgs, err := cm.GetCmppSubmit2ReqPkg(message)
 	if err != nil {
 		log.Logger.Error("[CmppClient][GetCmppSubmit2ReqPkg] Error:", zap.Error(err))
-		return
+		return err
 	}
 
 	for _, pkg := range pkgs {
-		cm.SendCmpp2SubmitPkg(pkg)
+		if err := cm.SendCmpp2SubmitPkg(pkg); err != nil {
+			return err
+		}
 	}
-
+	return nil
 }
 
-func (sm *CmppClientManager) SendCmpp2SubmitPkg(pkg *cmpp.Cmpp2SubmitReqPkt) {
+func (sm *CmppClientManager) SendCmpp2SubmitPkg(pkg *cmpp.Cmpp2SubmitReqPkt) error {
+	if sm.IsDraining() {
+		log.Logger.Error("[CmppClient][SendCmpp2SubmitPkg] Error: client is draining",
+			zap.String("Addr", sm.Addr),
+			zap.String("UserName", sm.UserName))
+		return ErrClientDraining
+	}
+	atomic.AddInt64(&sm.queued, 1)
 	sm.Cmpp2SubmitChan <- pkg
+	return nil
 }
 
 func (cm *CmppClientManager) Cmpp2SubmitResp(resp *cmpp.Cmpp2SubmitRspPkt) error {
+	cm.submitRespReceived(resp.SeqId, resp.MsgId, uint32(resp.Result))
 	if resp.Result == 0 {
 		log.Logger.Info("[CmppClient][Cmpp2SubmitResp] Success",
 			zap.String("Addr", cm.Addr),
@@ -106,12 +132,25 @@ func (cm *CmppClientManager) Cmpp2SubmitResp(resp *cmpp.Cmpp2SubmitRspPkt) error
 // =====================Cmpp3Submit=====================
 func (cm *CmppClientManager) GetCmppSubmit3ReqPkg(message *config.TextMessages) ([]*cmpp.Cmpp3SubmitReqPkt, error) {
 	packets := make([]*cmpp.Cmpp3SubmitReqPkt, 0)
-	content, err := cmpputils.Utf8ToUcs2(message.Content)
+	destTerminalIds, err := DestTerminalIds(message)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, units, err := EncodeContent(message.Content, message.Encoding)
 	if err != nil {
 		return nil, err
 	}
 
-	chunks := cm.SplitLongSms(content)
+	fields, err := cm.ResolveSubmitFields(message)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := cm.SplitLongSms(units, enc)
+	if err != nil {
+		return nil, err
+	}
 	var tpUdhi uint8
 	if len(chunks) > 1 {
 		tpUdhi = 1
@@ -126,25 +165,27 @@ func (cm *CmppClientManager) GetCmppSubmit3ReqPkg(message *config.TextMessages)
 		p := &cmpp.Cmpp3SubmitReqPkt{
 			PkTotal:            uint8(len(chunks)),
 			PkNumber:           uint8(i + 1),
-			RegisteredDelivery: 1,
-			MsgLevel:           1,
-			ServiceId:          cm.SpId,
-			FeeUserType:        2,
-			FeeTerminalId:      message.Phone,
-			FeeTerminalType:    0,
+			RegisteredDelivery: fields.RegisteredDelivery,
+			MsgLevel:           fields.MsgLevel,
+			ServiceId:          fields.ServiceId,
+			FeeUserType:        fields.FeeUserType,
+			FeeTerminalId:      fields.FeeTerminalId,
+			FeeTerminalType:    fields.FeeTerminalType,
+			TpPid:              fields.TpPid,
 			TpUdhi:             tpUdhi,
-			MsgFmt:             8,
-			MsgSrc:             cm.SpId,
-			FeeType:            "02",
-			FeeCode:            "10",
-			ValidTime:          "151105131555101+",
-			AtTime:             "",
+			MsgFmt:             enc.MsgFmt,
+			MsgSrc:             fields.MsgSrc,
+			FeeType:            fields.FeeType,
+			FeeCode:            fields.FeeCode,
+			ValidTime:          fields.ValidTime,
+			AtTime:             fields.AtTime,
 			SrcId:              srcId,
-			DestUsrTl:          1,
-			DestTerminalId:     []string{message.Phone},
-			DestTerminalType:   0,
+			DestUsrTl:          uint8(len(destTerminalIds)),
+			DestTerminalId:     destTerminalIds,
+			DestTerminalType:   fields.DestTerminalType,
 			MsgLength:          uint8(len(chunk)),
 			MsgContent:         string(chunk),
+			LinkId:             fields.LinkId,
 		}
 		packets = append(packets, p)
 	}
@@ -152,23 +193,35 @@ func (cm *CmppClientManager) GetCmppSubmit3ReqPkg(message *config.TextMessages)
 	return packets, nil
 }
 
-func (cm *CmppClientManager) Cmpp3Submit(message *config.TextMessages) {
+// 生成并发送提交包，生成失败或连接排空中时返回错误
+func (cm *CmppClientManager) Cmpp3Submit(message *config.TextMessages) error {
 	pkgs, err := cm.GetCmppSubmit3ReqPkg(message)
 	if err != nil {
 		log.Logger.Error("[CmppClient][GetCmppSubmit3ReqPkg] Error:", zap.Error(err))
-		return
+		return err
 	}
 	for _, pkg := range pkgs {
-		cm.SendCmpp3SubmitPkg(pkg)
+		if err := cm.SendCmpp3SubmitPkg(pkg); err != nil {
+			return err
+		}
 	}
-
+	return nil
 }
 
-func (sm *CmppClientManager) SendCmpp3SubmitPkg(pkg *cmpp.Cmpp3SubmitReqPkt) {
+func (sm *CmppClientManager) SendCmpp3SubmitPkg(pkg *cmpp.Cmpp3SubmitReqPkt) error {
+	if sm.IsDraining() {
+		log.Logger.Error("[CmppClient][SendCmpp3SubmitPkg] Error: client is draining",
+			zap.String("Addr", sm.Addr),
+			zap.String("UserName", sm.UserName))
+		return ErrClientDraining
+	}
+	atomic.AddInt64(&sm.queued, 1)
 	sm.Cmpp3SubmitChan <- pkg
+	return nil
 }
 
 func (cm *CmppClientManager) Cmpp3SubmitResp(resp *cmpp.Cmpp3SubmitRspPkt) error {
+	cm.submitRespReceived(resp.SeqId, resp.MsgId, uint32(resp.Result))
 	if resp.Result == 0 {
 		log.Logger.Info("[CmppClient][Cmpp3SubmitResp] Success", zap.Uint32("SeqId", resp.SeqId), zap.Uint64("MsgId", resp.MsgId))
 		statistics.CollectService.Service.AddPackerStatistics("Client", "SubmitResp", true)
@@ -180,6 +233,145 @@ func (cm *CmppClientManager) Cmpp3SubmitResp(resp *cmpp.Cmpp3SubmitRspPkt) error
 }
 
 // =====================Cmpp3Submit=====================
+
+const (
+	MaxDestUsrTl            = 100 // 群发单个提交包最多接收号码数
+	SubmitResultFlowControl = 8   // SubmitResp 流量控制错
+)
+
+var (
+	ErrTooManyDestTerminals = errors.New("dest terminals exceed 100")
+	ErrClientDraining       = errors.New("client is draining")
+)
+
+// 提交包接收号码，配置 phones 时为群发
+func DestTerminalIds(message *config.TextMessages) ([]string, error) {
+	if len(message.Phones) == 0 {
+		return []string{message.Phone}, nil
+	}
+	if len(message.Phones) > MaxDestUsrTl {
+		return nil, ErrTooManyDestTerminals
+	}
+	return message.Phones, nil
+}
+
+// 网关反馈累计值快照
+func (cm *CmppClientManager) Feedback() SubmitFeedback {
+	return SubmitFeedback{
+		Success:          atomic.LoadUint64(&cm.feedback.Success),
+		Failed:           atomic.LoadUint64(&cm.feedback.Failed),
+		FlowControl:      atomic.LoadUint64(&cm.feedback.FlowControl),
+		Timeout:          atomic.LoadUint64(&cm.feedback.Timeout),
+		LatencySum:       atomic.LoadUint64(&cm.feedback.LatencySum),
+		Reports:          atomic.LoadUint64(&cm.feedback.Reports),
+		ReportLatencySum: atomic.LoadUint64(&cm.feedback.ReportLatencySum),
+	}
+}
+
+// 分配序列号并登记待发送的提交包，等待 SubmitResp
+func (cm *CmppClientManager) submitSent(pkg cmpp.Packer, registeredDelivery uint8, destTerminalIds []string) uint32 {
+	atomic.AddInt64(&cm.waitSubmitResp, 1)
+	statistics.CollectService.Submits.AddSent()
+	return cm.storeSubmit(&SubmitRecord{
+		Pkt:                pkg,
+		Attempts:           1,
+		RegisteredDelivery: registeredDelivery,
+		DestTerminalIds:    destTerminalIds,
+	})
+}
+
+// 发送前按账号 TPS 上限及连接窗口大小等待，连接关闭时返回 false
+func (cm *CmppClientManager) acquireSubmit() bool {
+	if cm.Limiter != nil {
+		if err := cm.Limiter.Wait(cm.Ctx); err != nil {
+			return false
+		}
+	}
+	if cm.window != nil {
+		select {
+		case cm.window <- struct{}{}:
+		case <-cm.Ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// 提交包结束等待 SubmitResp（收到响应、发送失败或最终超时），释放窗口
+func (cm *CmppClientManager) submitDone() {
+	atomic.AddInt64(&cm.waitSubmitResp, -1)
+	if cm.window != nil {
+		<-cm.window
+	}
+}
+
+// 分配序列号并登记，重发时使用新的序列号
+func (cm *CmppClientManager) storeSubmit(record *SubmitRecord) uint32 {
+	seqId := cm.nextSeqId()
+	record.SendTime = time.Now()
+	cm.pendingSubmits.Store(seqId, record)
+	return seqId
+}
+
+// 提交包发送失败，撤销登记
+func (cm *CmppClientManager) submitSendFailed(seqId uint32) {
+	if _, ok := cm.pendingSubmits.LoadAndDelete(seqId); ok {
+		cm.submitDone()
+	}
+}
+
+// 收到 SubmitResp：可重发错误码按重发策略重发；提交成功且需要状态报告时，按 MsgId 登记每个接收号码等待状态报告
+func (cm *CmppClientManager) submitRespReceived(seqId uint32, msgId uint64, result uint32) {
+	r, ok := cm.pendingSubmits.LoadAndDelete(seqId)
+	if !ok {
+		return
+	}
+	record := r.(*SubmitRecord)
+	if result == 0 {
+		latency := time.Since(record.SendTime)
+		atomic.AddUint64(&cm.feedback.Success, 1)
+		atomic.AddUint64(&cm.feedback.LatencySum, uint64(latency/time.Microsecond))
+		statistics.CollectService.Submits.AddSuccess(latency)
+	} else {
+		atomic.AddUint64(&cm.feedback.Failed, 1)
+		if result == SubmitResultFlowControl {
+			atomic.AddUint64(&cm.feedback.FlowControl, 1)
+		}
+	}
+	retryable := result != 0 && cm.Resend.RetryResults[result]
+	if retryable && cm.resendSubmit(record, "Result") {
+		return
+	}
+	cm.submitDone()
+	if result != 0 {
+		// 不可重发错误码，或可重发错误码已达最大发送次数
+		statistics.CollectService.Submits.AddFailedResult(result)
+		return
+	}
+	if record.RegisteredDelivery == 1 {
+		early := statistics.CollectService.Reports.Submitted(msgId, record.DestTerminalIds, record.SendTime)
+		atomic.AddInt64(&cm.waitReports, int64(len(record.DestTerminalIds)-early))
+	}
+}
+
+// 收到状态报告，与已提交短信对账
+func (cm *CmppClientManager) reportReceived(msgId uint64, phone, stat string) {
+	result, latency := statistics.CollectService.Reports.Received(msgId, phone, stat)
+	if result == statistics.ReportMatched {
+		atomic.AddInt64(&cm.waitReports, -1)
+		atomic.AddUint64(&cm.feedback.Reports, 1)
+		atomic.AddUint64(&cm.feedback.ReportLatencySum, uint64(latency/time.Microsecond))
+		return
+	}
+	log.Logger.Warn("[CmppClient][Report] Unmatched",
+		zap.String("Addr", cm.Addr),
+		zap.String("UserName", cm.UserName),
+		zap.Uint64("MsgId", msgId),
+		zap.String("Phone", phone),
+		zap.String("Stat", stat),
+		zap.String("Result", result.String()))
+}
+
 // =====================CmppClient=====================
 
 // =====================CmppServer=====================
@@ -192,12 +384,25 @@ func (sm *CmppServerManager) Cmpp2Submit(req *cmpp.Packet, res *cmpp.Response) (
 	account := a.(*Conn)
 	if !ok {
 		log.Logger.Error("[CmppServer][Cmpp2Submit] Error",
-			zap.String("Phone", pkg.DestTerminalId[0]),
+			zap.Strings("Phones", pkg.DestTerminalId),
 			zap.String("RemoteAddr", addr))
 		statistics.CollectService.Service.AddPackerStatistics("Server", "Submit", false)
 		return false, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnOthers]
 	}
 
+	// 按服务端模拟行为延迟响应或返回错误码
+	if result := currentServerBehavior().submitResult(); result != 0 {
+		log.Logger.Warn("[CmppServer][Cmpp2Submit] Inject Result",
+			zap.String("SpId", account.spId),
+			zap.Strings("Phones", pkg.DestTerminalId),
+			zap.Uint32("Result", result),
+			zap.String("RemoteAddr", addr))
+		statistics.CollectService.Service.AddPackerStatistics("Server", "Submit", false)
+		account.addSubmit(len(pkg.DestTerminalId), false)
+		resp.Result = uint8(result)
+		return false, nil
+	}
+
 	seqId := <-sm.SubmitSeqId
 	msgId, err := GetMsgId(account.spId, seqId)
 	if err != nil {
@@ -206,19 +411,24 @@ func (sm *CmppServerManager) Cmpp2Submit(req *cmpp.Packet, res *cmpp.Response) (
 			zap.Uint32("SeqId", pkg.SeqId),
 			zap.Error(err))
 		statistics.CollectService.Service.AddPackerStatistics("Server", "Submit", false)
+		account.addSubmit(len(pkg.DestTerminalId), false)
 		return false, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnOthers]
 	}
 
 	log.Logger.Info("[CmppServer][Cmpp2Submit] Success",
 		zap.String("SpId", account.spId),
-		zap.String("Phone", pkg.DestTerminalId[0]),
+		zap.Strings("Phones", pkg.DestTerminalId),
 		zap.Uint16("SeqId", seqId),
 		zap.Uint64("MsgId", msgId),
 		zap.String("RemoteAddr", addr))
 	statistics.CollectService.Service.AddPackerStatistics("Server", "Submit", true)
+	account.addSubmit(len(pkg.DestTerminalId), true)
 	statistics.CollectService.Service.AddPackerStatistics("Server", "SubmitResp", true)
 	resp.MsgId = msgId
-	go sm.MockCmpp2Deliver(addr, account.spCode, msgId, pkg)
+	// 不需要状态报告时不推送
+	if pkg.RegisteredDelivery == 1 {
+		go sm.MockCmpp2Deliver(addr, account.spCode, msgId, pkg)
+	}
 	return false, nil
 }
 
@@ -231,12 +441,25 @@ func (sm *CmppServerManager) Cmpp3Submit(req *cmpp.Packet, res *cmpp.Response) (
 	account := a.(*Conn)
 	if !ok {
 		log.Logger.Error("[CmppServer][Cmpp3Submit] Error",
-			zap.String("Phone", pkg.DestTerminalId[0]),
+			zap.Strings("Phones", pkg.DestTerminalId),
 			zap.String("RemoteAddr", addr))
 		statistics.CollectService.Service.AddPackerStatistics("Server", "Submit", false)
 		return false, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnOthers]
 	}
 
+	// 按服务端模拟行为延迟响应或返回错误码
+	if result := currentServerBehavior().submitResult(); result != 0 {
+		log.Logger.Warn("[CmppServer][Cmpp3Submit] Inject Result",
+			zap.String("SpId", account.spId),
+			zap.Strings("Phones", pkg.DestTerminalId),
+			zap.Uint32("Result", result),
+			zap.String("RemoteAddr", addr))
+		statistics.CollectService.Service.AddPackerStatistics("Server", "Submit", false)
+		account.addSubmit(len(pkg.DestTerminalId), false)
+		resp.Result = result
+		return false, nil
+	}
+
 	seqId := <-sm.SubmitSeqId
 	msgId, err := GetMsgId(account.spId, seqId)
 	if err != nil {
@@ -245,56 +468,84 @@ func (sm *CmppServerManager) Cmpp3Submit(req *cmpp.Packet, res *cmpp.Response) (
 			zap.Uint32("SeqId", pkg.SeqId),
 			zap.Error(err))
 		statistics.CollectService.Service.AddPackerStatistics("Server", "Submit", false)
+		account.addSubmit(len(pkg.DestTerminalId), false)
 		return false, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnOthers]
 	}
 	resp.MsgId = msgId
 	log.Logger.Info("[CmppServer][Cmpp3Submit] Success",
 		zap.String("SpId", account.spId),
-		zap.String("Phone", pkg.DestTerminalId[0]),
+		zap.Strings("Phones", pkg.DestTerminalId),
 		zap.Uint16("SeqId", seqId),
 		zap.Uint64("MsgId", msgId),
 		zap.String("RemoteAddr", addr))
 	statistics.CollectService.Service.AddPackerStatistics("Server", "Submit", true)
+	account.addSubmit(len(pkg.DestTerminalId), true)
 	statistics.CollectService.Service.AddPackerStatistics("Server", "SubmitResp", true)
-	go sm.MockCmpp3Deliver(addr, account.spCode, msgId, pkg)
+	// 不需要状态报告时不推送
+	if pkg.RegisteredDelivery == 1 {
+		go sm.MockCmpp3Deliver(addr, account.spCode, msgId, pkg)
+	}
 	return false, nil
 }
 
 // =====================CmppServer=====================
 
-var TpUdhiSeq byte = 0x00
+const (
+	udhLength8BitRef  = 6   // 05 00 03 ref total seq
+	udhLength16BitRef = 7   // 06 08 04 refHi refLo total seq
+	maxSegmentNum     = 255 // PkTotal 最大值
+)
+
+var ErrTooManySegments = errors.New("long sms exceeds 255 segments")
 
-func (cm *CmppClientManager) SplitLongSms(content string) [][]byte {
-	smsLength := 140
-	smsHeaderLength := 6
-	smsBodyLen := smsLength - smsHeaderLength
-	contentBytes := []byte(content)
+// 按编码长度限制拆分长短信，超长时每条加上 UDH 头
+// 拆分以编码单元为边界，不会拆开 UCS2 码元及代理对（emoji）、GBK 双字节字符
+// 参考号按连接原子递增，UdhRef16Bit 时使用 16 位参考号（IEI 0x08）
+func (cm *CmppClientManager) SplitLongSms(units [][]byte, enc *MsgEncoding) ([][]byte, error) {
 	var chunks [][]byte
-	num := 1
-	if (len(content)) > 140 {
-		num = int(math.Ceil(float64(len(content)) / float64(smsBodyLen)))
+	if unitsLength(units) <= enc.Single {
+		chunks = append(chunks, packUnits(units, enc.Single)...)
+		if len(chunks) == 0 {
+			chunks = append(chunks, []byte{})
+		}
+		return chunks, nil
+	}
+
+	udhLength := udhLength8BitRef
+	if cm.UdhRef16Bit {
+		udhLength = udhLength16BitRef
 	}
-	if num == 1 {
-		chunks = append(chunks, contentBytes)
-		return chunks
+	segments := packUnits(units, segmentSize(enc, cm.UdhRef16Bit))
+	num := len(segments)
+	if num > maxSegmentNum {
+		return nil, ErrTooManySegments
 	}
-	tpUdhiHeader := []byte{0x05, 0x00, 0x03, TpUdhiSeq, byte(num)}
-	TpUdhiSeq++
 
-	for i := 0; i < num; i++ {
-		chunk := tpUdhiHeader
-		chunk = append(chunk, byte(i+1))
-		smsBodyLen := smsLength - smsHeaderLength
-		offset := i * smsBodyLen
-		max := offset + smsBodyLen
-		if max > len(content) {
-			max = len(content)
-		}
+	ref := atomic.AddUint32(&cm.udhRef, 1)
+	var udh []byte
+	if cm.UdhRef16Bit {
+		udh = []byte{0x06, 0x08, 0x04, byte(ref >> 8), byte(ref), byte(num)}
+	} else {
+		udh = []byte{0x05, 0x00, 0x03, byte(ref), byte(num)}
+	}
 
-		chunk = append(chunk, contentBytes[offset:max]...)
+	for i, segment := range segments {
+		chunk := make([]byte, 0, udhLength+len(segment))
+		chunk = append(chunk, udh...)
+		chunk = append(chunk, byte(i+1))
+		chunk = append(chunk, segment...)
 		chunks = append(chunks, chunk)
 	}
-	return chunks
+	return chunks, nil
+}
+
+// 短信按该连接的编码及 UDH 参考号长度拆分后的提交包数
+func (cm *CmppClientManager) SegmentCount(content, encoding string) (int, error) {
+	enc, units, err := EncodeContent(content, encoding)
+	if err != nil {
+		return 0, err
+	}
+	return SegmentCount(units, enc, cm.UdhRef16Bit), nil
 }
 
 func GetMsgId(spId string, seqId uint16) (uint64, error) {
@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"fmt"
+	"mock-cmpp-stress-test/config"
+	"strings"
+	"time"
+)
+
+// 发送时确定的提交包字段
+type SubmitFields struct {
+	RegisteredDelivery uint8
+	MsgLevel           uint8
+	ServiceId          string
+	FeeUserType        uint8
+	FeeTerminalId      string
+	FeeTerminalType    uint8
+	TpPid              uint8
+	MsgSrc             string
+	FeeType            string
+	FeeCode            string
+	ValidTime          string
+	AtTime             string
+	DestTerminalType   uint8
+	LinkId             string
+}
+
+// 按 默认值 < 账号配置 < 短信配置 的优先级合并提交包字段，相对时间按当前时间计算
+func (cm *CmppClientManager) ResolveSubmitFields(message *config.TextMessages) (*SubmitFields, error) {
+	f := &SubmitFields{
+		RegisteredDelivery: 1,
+		MsgLevel:           1,
+		ServiceId:          cm.SpId,
+		FeeUserType:        2,
+		FeeTerminalId:      message.Phone,
+		MsgSrc:             cm.SpId,
+		FeeType:            "02",
+		FeeCode:            "10",
+	}
+	if f.FeeTerminalId == "" && len(message.Phones) > 0 {
+		f.FeeTerminalId = message.Phones[0]
+	}
+	f.merge(cm.Account.Submit)
+	f.merge(message.Submit)
+
+	now := time.Now()
+	var err error
+	if f.ValidTime, err = ResolveCmppTime(f.ValidTime, now); err != nil {
+		return nil, err
+	}
+	if f.AtTime, err = ResolveCmppTime(f.AtTime, now); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *SubmitFields) merge(c *config.SubmitFields) {
+	if c == nil {
+		return
+	}
+	if c.RegisteredDelivery != nil {
+		f.RegisteredDelivery = *c.RegisteredDelivery
+	}
+	if c.MsgLevel != nil {
+		f.MsgLevel = *c.MsgLevel
+	}
+	if c.ServiceId != nil {
+		f.ServiceId = *c.ServiceId
+	}
+	if c.FeeUserType != nil {
+		f.FeeUserType = *c.FeeUserType
+	}
+	if c.FeeTerminalId != nil {
+		f.FeeTerminalId = *c.FeeTerminalId
+	}
+	if c.FeeTerminalType != nil {
+		f.FeeTerminalType = *c.FeeTerminalType
+	}
+	if c.TpPid != nil {
+		f.TpPid = *c.TpPid
+	}
+	if c.MsgSrc != nil {
+		f.MsgSrc = *c.MsgSrc
+	}
+	if c.FeeType != nil {
+		f.FeeType = *c.FeeType
+	}
+	if c.FeeCode != nil {
+		f.FeeCode = *c.FeeCode
+	}
+	if c.ValidTime != nil {
+		f.ValidTime = *c.ValidTime
+	}
+	if c.AtTime != nil {
+		f.AtTime = *c.AtTime
+	}
+	if c.DestTerminalType != nil {
+		f.DestTerminalType = *c.DestTerminalType
+	}
+	if c.LinkId != nil {
+		f.LinkId = *c.LinkId
+	}
+}
+
+// + 开头的相对时间（如 +2h30m）转换为 CMPP 绝对时间格式，其余原样返回
+func ResolveCmppTime(value string, now time.Time) (string, error) {
+	if !strings.HasPrefix(value, "+") {
+		return value, nil
+	}
+	d, err := time.ParseDuration(value[1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid relative time %s: %s", value, err.Error())
+	}
+	return FormatCmppTime(now.Add(d)), nil
+}
+
+// CMPP 绝对时间格式 YYMMDDhhmmsstnnp：t 为十分之一秒，nn 为与 UTC 相差的 1/4 小时数，p 为 + 或 -
+func FormatCmppTime(t time.Time) string {
+	_, offset := t.Zone()
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%d%02d%s", t.Format("060102150405"), t.Nanosecond()/int(100*time.Millisecond), offset/(15*60), sign)
+}
@@ -1,7 +1,9 @@
 package pkg
 
 import (
+	"errors"
 	cmpp "github.com/bigwhite/gocmpp"
+	"time"
 )
 
 // =====================CmppClient=====================
@@ -15,5 +17,24 @@ func (cm *CmppClientManager) CmppTerminateReq(pkg *cmpp.CmppTerminateReqPkt) err
 }
 
 func (cm *CmppClientManager) CmppTerminateRsp(pkg *cmpp.CmppTerminateRspPkt) error {
+	select {
+	case <-cm.terminated:
+	default:
+		close(cm.terminated)
+	}
 	return nil
 }
+
+// 客户端发送拆除连接请求，并等待服务端应答
+func (cm *CmppClientManager) Terminate() error {
+	if err := cm.Client.SendRspPkt(&cmpp.CmppTerminateReqPkt{}, cm.nextSeqId()); err != nil {
+		return err
+	}
+
+	select {
+	case <-cm.terminated:
+		return nil
+	case <-time.After(cm.Timeout):
+		return errors.New("wait terminate resp timeout")
+	}
+}
@@ -3,12 +3,25 @@ package pkg
 import (
 	"context"
 	cmpp "github.com/bigwhite/gocmpp"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/utils/token_bucket"
 	"sync"
 	"time"
 )
 
 const (
-	defaultTimeout = 5 * time.Second
+	defaultTimeout      = 5 * time.Second
+	defaultDrainTimeout = 10 * time.Second
+	// 提交包等待 SubmitResp 的默认超时时间
+	defaultSubmitTimeout = 60 * time.Second
+
+	defaultActiveTestInterval = 10 * time.Second
+	defaultMaxNoRespPkgNum    = 3
+
+	// 每个心跳间隔内检查链路空闲的次数
+	activeTestTicks = 4
+	// 链路繁忙时采样心跳 RTT 的间隔
+	activeTestSampleInterval = time.Minute
 )
 
 // cmpp client
@@ -20,20 +33,74 @@ type CmppClientManager struct {
 	Password string    // cmpp connect password
 	SpId     string    // cmpp submit sp_id
 	SpCode   string    // cmpp submit sp_code
+	Account  config.CmppAccount
 	//Retries            uint          // cmpp connect retry times
-	Timeout            time.Duration // cmpp connect timeout
-	ActiveTestInterval time.Duration // cmpp connect timeout
+	Timeout            time.Duration             // cmpp connect timeout
+	ActiveTestInterval time.Duration             // cmpp 链路空闲时的心跳间隔
+	MaxNoRespPkgNum    uint                      // 允许连续未响应的心跳个数
+	DrainTimeout       time.Duration             // cmpp client drain timeout
+	UdhRef16Bit        bool                      // 长短信使用 16 位参考号
+	SubmitTimeout      time.Duration             // 提交包等待 SubmitResp 超时时间
+	Resend             ResendPolicy              // 提交包重发策略
+	DeliverRespFault   *DeliverRespFault         // DeliverResp 故障注入
+	Key                string                    // 在 clients 中的 key
+	Limiter            *token_bucket.TokenBucket // 账号 TPS 上限，同一账号的连接共用
 
-	Connected    bool
+	connected    int32 // 是否已连接，通过 IsConnected 读取
+	draining     int32 // 关闭前排空阶段，不再接收新的提交，通过 IsDraining 读取
 	ConnErrCount uint
 	Ctx          context.Context
 	cancel       context.CancelFunc
 
+	udhRef         uint32   // 长短信参考号
+	seqId          uint32   // 请求包序列号（提交、心跳、拆除连接），先登记再发送，避免响应先于登记到达
+	queued         int64    // 已入队但尚未发送的提交包数
+	waitSubmitResp int64    // 已发送但尚未收到 SubmitResp 的提交包数
+	waitReports    int64    // 已提交成功但尚未收到的状态报告数
+	pendingSubmits sync.Map // map[uint32]*SubmitRecord 等待 SubmitResp 的提交包
+	feedback       SubmitFeedback
+	autoReplies    []*autoReplyRule // 上行短信自动回复规则
+
+	lastRecv         int64         // 最近一次收到数据包的时间，UnixNano
+	lastActiveTest   int64         // 最近一次发送心跳的时间，UnixNano
+	activeTestNoResp int32         // 连续未响应的心跳个数
+	activeTests      sync.Map      // map[uint32]time.Time 等待响应的心跳
+	queries          sync.Map      // map[uint32]time.Time 等待响应的查询
+	window           chan struct{} // 等待 SubmitResp 的提交包窗口
+	terminated       chan struct{} // 收到 CMPP_TERMINATE_RESP
+
 	Client          *cmpp.Client // cmpp client
 	Cmpp2SubmitChan chan *cmpp.Cmpp2SubmitReqPkt
 	Cmpp3SubmitChan chan *cmpp.Cmpp3SubmitReqPkt
 }
 
+// 已发送、等待 SubmitResp 的提交记录
+type SubmitRecord struct {
+	Pkt                cmpp.Packer
+	SendTime           time.Time
+	Attempts           uint // 已发送次数
+	RegisteredDelivery uint8
+	DestTerminalIds    []string
+}
+
+// 网关反馈累计值，用于自适应调整发送速率
+type SubmitFeedback struct {
+	Success          uint64 // 成功的 SubmitResp 数
+	Failed           uint64 // 返回错误码的 SubmitResp 数
+	FlowControl      uint64 // 流量控制错误的 SubmitResp 数
+	Timeout          uint64 // 等待 SubmitResp 超时数
+	LatencySum       uint64 // 成功 SubmitResp 的响应时间之和，单位微秒
+	Reports          uint64 // 匹配的状态报告数
+	ReportLatencySum uint64 // 匹配的状态报告延迟之和，单位微秒
+}
+
+// 提交包重发策略
+type ResendPolicy struct {
+	MaxAttempts  uint
+	RetryResults map[uint32]bool
+	Interval     time.Duration
+}
+
 // cmpp test
 type CmppServerManager struct {
 	// setting
@@ -53,4 +120,11 @@ type Conn struct {
 	password string // cmpp connect auth password
 	spId     string // cmpp submit sp_id
 	spCode   string // cmpp submit sp_code
+
+	// 该连接的累计值，用于响应 CMPP_QUERY
+	mtMsg uint64 // 收到的提交包数
+	mtUsr uint64 // 提交包的号码数
+	mtScs uint64 // 提交成功数
+	mtFl  uint64 // 提交失败数
+	moScs uint64 // 推送的上行短信数
 }
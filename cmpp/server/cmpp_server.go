@@ -2,10 +2,13 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"math/rand"
 	"mock-cmpp-stress-test/cmpp/pkg"
 	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/utils/msg_template"
 	"time"
 )
 
@@ -47,7 +50,14 @@ func (s *CmppServer) Start() error {
 			csm.Stop()
 		}
 	}()
+	pkg.SetServerBehavior(s.cfg.Behavior)
 	go s.StartDeliver()
+	if s.cfg.Mo != nil && s.cfg.Mo.Enable {
+		if err := s.StartMo(); err != nil {
+			s.Logger.Error("Cmpp Server Mock Mo Error", zap.Error(err))
+			return err
+		}
+	}
 
 	s.Logger.Info("Cmpp Server Start Success")
 	return nil
@@ -57,12 +67,79 @@ func (s *CmppServer) Stop() error {
 	if !s.cfg.Enable {
 		return nil
 	}
-	// 关闭当前所有连接
+	// 停止推送回执、上行短信，关闭当前所有连接
+	s.cancel()
 	csm.Stop()
 	s.Logger.Info("Cmpp Server Stop Success")
 	return nil
 }
 
+const (
+	defaultMoInterval = 1000
+	defaultMoPhone    = "139{{rand_digits:8}}"
+)
+
+// 定时向已连接的客户端推送模拟上行短信
+func (s *CmppServer) StartMo() error {
+	cfg := s.cfg.Mo
+	if len(cfg.Contents) == 0 {
+		return errors.New("mock mo contents can't be empty")
+	}
+	if s.cfg.Auths != nil {
+		for _, auth := range *s.cfg.Auths {
+			if err := pkg.CheckDestId(auth.SpCode, cfg.Extend); err != nil {
+				return err
+			}
+		}
+	}
+	phoneTpl := cfg.Phone
+	if phoneTpl == "" {
+		phoneTpl = defaultMoPhone
+	}
+	phone, err := msg_template.Compile(phoneTpl)
+	if err != nil {
+		return err
+	}
+	contents := make([]*msg_template.Template, 0, len(cfg.Contents))
+	for _, c := range cfg.Contents {
+		t, err := msg_template.Compile(c)
+		if err != nil {
+			return err
+		}
+		contents = append(contents, t)
+	}
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = defaultMoInterval
+	}
+
+	go func() {
+		tk := time.NewTicker(time.Duration(interval) * time.Millisecond)
+		defer tk.Stop()
+		seq := uint64(0)
+		for {
+			select {
+			case <-tk.C:
+				seq++
+				ctx := &msg_template.Context{Seq: seq}
+				content := contents[rand.Intn(len(contents))]
+				csm.MockMo(phone.Render(ctx), content.Render(ctx), cfg.Extend)
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// 向用户名为 username 的一个连接推送模拟上行短信，仅本进程启动了 cmpp 服务端时可用
+func MockMo(username, phone, content, extend string) error {
+	if csm.UserMap == nil {
+		return errors.New("cmpp server is not running")
+	}
+	return csm.MockMoTo(username, phone, content, extend)
+}
+
 func (s *CmppServer) StartDeliver() {
 	cmpp2DeliverPkgs := make([]*pkg.MockCmpp2DeliverPkg, 0)
 	cmpp3DeliverPkgs := make([]*pkg.MockCmpp3DeliverPkg, 0)
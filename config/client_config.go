@@ -1,20 +1,99 @@
 package config
 
 type CmppAccount struct {
-	Username string `toml:"username"`
-	Password string `toml:"password"`
-	Ip       string `toml:"ip"`
-	Port     uint16 `toml:"port"`
-	SpID     string `toml:"sp_id"`
-	SpCode   string `toml:"sp_code"`
+	Username string        `toml:"username"`
+	Password string        `toml:"password"`
+	Ip       string        `toml:"ip"`
+	Port     uint16        `toml:"port"`
+	SpID     string        `toml:"sp_id"`
+	SpCode   string        `toml:"sp_code"`
+	Submit   *SubmitFields `toml:"submit"` // 该账号提交包字段
+
+	// 以下配置为 0 或空时使用 [cmpp_client] 中的全局配置
+	Version            string `toml:"version"`
+	TimeOut            uint   `toml:"read_timeout"`
+	ActiveTestInterval uint   `toml:"active_test_interval"`
+	MaxNoRespPkgNum    uint   `toml:"max_no_resp_pkg_num"`
+
+	Window      uint `toml:"window"`      // 每个连接等待 SubmitResp 的最大提交包数，0 表示不限制
+	Connections uint `toml:"connections"` // 连接数，默认 1
+	Tps         uint `toml:"tps"`         // 该账号所有连接每秒最多发送的提交包数，0 表示不限制
+}
+
+// 账号配置覆盖全局配置后的客户端配置
+func (c *CmppClientConfig) WithAccount(account CmppAccount) *CmppClientConfig {
+	cfg := *c
+	if account.Version != "" {
+		cfg.Version = account.Version
+	}
+	if account.TimeOut != 0 {
+		cfg.TimeOut = account.TimeOut
+	}
+	if account.ActiveTestInterval != 0 {
+		cfg.ActiveTestInterval = account.ActiveTestInterval
+	}
+	if account.MaxNoRespPkgNum != 0 {
+		cfg.MaxNoRespPkgNum = account.MaxNoRespPkgNum
+	}
+	return &cfg
+}
+
+// 提交包字段，未配置的字段依次使用账号配置、默认值
+// ValidTime、AtTime 可配置绝对时间（YYMMDDhhmmsstnnp），或 + 开头的相对时间（如 +2h30m），相对时间在发送时计算
+type SubmitFields struct {
+	RegisteredDelivery *uint8  `toml:"registered_delivery" json:"registered_delivery"`
+	MsgLevel           *uint8  `toml:"msg_level" json:"msg_level"`
+	ServiceId          *string `toml:"service_id" json:"service_id"`
+	FeeUserType        *uint8  `toml:"fee_user_type" json:"fee_user_type"`
+	FeeTerminalId      *string `toml:"fee_terminal_id" json:"fee_terminal_id"`
+	FeeTerminalType    *uint8  `toml:"fee_terminal_type" json:"fee_terminal_type"` // 仅 cmpp3.0
+	TpPid              *uint8  `toml:"tp_pid" json:"tp_pid"`
+	MsgSrc             *string `toml:"msg_src" json:"msg_src"`
+	FeeType            *string `toml:"fee_type" json:"fee_type"`
+	FeeCode            *string `toml:"fee_code" json:"fee_code"`
+	ValidTime          *string `toml:"valid_time" json:"valid_time"`
+	AtTime             *string `toml:"at_time" json:"at_time"`
+	DestTerminalType   *uint8  `toml:"dest_terminal_type" json:"dest_terminal_type"` // 仅 cmpp3.0
+	LinkId             *string `toml:"link_id" json:"link_id"`                       // 仅 cmpp3.0
 }
 
 type CmppClientConfig struct {
-	Version            string         `toml:"version"`
-	TimeOut            uint           `toml:"read_timeout"`
-	Retries            uint           `toml:"retries"`
-	ActiveTestInterval uint           `toml:"active_test_interval"`
-	MaxNoRespPkgNum    uint           `toml:"max_no_resp_pkg_num"`
-	Enable             bool           `toml:"enable"`
-	Accounts           *[]CmppAccount `toml:"accounts"`
+	Version            string                  `toml:"version"`
+	TimeOut            uint                    `toml:"read_timeout"`
+	Retries            uint                    `toml:"retries"`
+	ActiveTestInterval uint                    `toml:"active_test_interval"`
+	MaxNoRespPkgNum    uint                    `toml:"max_no_resp_pkg_num"`
+	DrainTimeout       uint                    `toml:"drain_timeout"`
+	UdhRef16Bit        bool                    `toml:"udh_ref_16bit"`
+	SubmitTimeout      uint                    `toml:"submit_timeout"`
+	Resend             *ResendConfig           `toml:"resend"`
+	AutoReplies        *[]AutoReply            `toml:"auto_replies"`
+	DeliverResp        *DeliverRespFaultConfig `toml:"deliver_resp"`
+	Enable             bool                    `toml:"enable"`
+	Accounts           *[]CmppAccount          `toml:"accounts"`
+}
+
+// 提交包重发策略：等待 SubmitResp 超时或返回可重发错误码时重发
+type ResendConfig struct {
+	MaxAttempts  uint     `toml:"max_attempts"`  // 最大发送次数（含首次）
+	RetryResults []uint32 `toml:"retry_results"` // 可重发的 SubmitResp 错误码
+	Interval     uint     `toml:"interval"`      // 重发间隔，单位毫秒
+}
+
+// 收到上行短信时按关键字自动回复，回复内容支持模板变量
+type AutoReply struct {
+	Keyword string `toml:"keyword"`
+	Match   string `toml:"match"` // 匹配方式：contains（默认）、prefix、exact、regex
+	Content string `toml:"content"`
+	Extend  string `toml:"extend"`
+}
+
+// DeliverResp 故障注入，比例取值 0~1
+type DeliverRespFaultConfig struct {
+	ErrorRate  float64  `toml:"error_rate"`  // 以错误码响应的比例
+	ErrorCodes []uint32 `toml:"error_codes"` // 错误码，随机选择，默认 9
+	DelayRate  float64  `toml:"delay_rate"`  // 延迟响应的比例
+	DelayMin   uint     `toml:"delay_min"`   // 延迟时间下限，单位毫秒
+	DelayMax   uint     `toml:"delay_max"`   // 延迟时间上限，单位毫秒
+	DropRate   float64  `toml:"drop_rate"`   // 不响应的比例
 }
@@ -7,23 +7,183 @@ import (
 )
 
 type TextMessages struct {
-	Extend  string `toml:"extend"`
-	Content string `toml:"content"`
-	Phone   string `toml:"phone"`
+	Extend   string        `toml:"extend" json:"extend"`
+	Content  string        `toml:"content" json:"content"`
+	Phone    string        `toml:"phone" json:"phone"`
+	Phones   []string      `toml:"phones" json:"phones"`     // 群发号码，最多 100 个，配置后忽略 phone
+	DestNum  int           `toml:"dest_num" json:"dest_num"` // 启用手机号生成器时，每条群发短信生成的号码个数
+	Encoding string        `toml:"encoding" json:"encoding"` // auto、ascii、binary、ucs2、gbk，默认 auto
+	Submit   *SubmitFields `toml:"submit" json:"submit"`     // 该短信提交包字段，优先于账号配置
+}
+
+// 从文件读取短信，流式读取不一次性加载
+type MessageFileConfig struct {
+	Enable bool   `toml:"enable"`
+	File   string `toml:"file"`
+	Format string `toml:"format"` // csv、jsonl，默认按文件后缀判断
+	Mode   string `toml:"mode"`   // sequential、random、weighted，默认 sequential
+	Window int    `toml:"window"` // random、weighted 模式下的随机选择窗口大小，默认 10000
+	Loop   bool   `toml:"loop"`   // 读完后从头循环
+	// 是否解析内容及手机号中的模板变量，默认原样发送；开启后每条记录单独解析，模板错误时压测停止
+	Template bool `toml:"template"`
 }
 
 type StressTestWorker struct {
-	Name         string `toml:"name"`
-	Concurrency  uint64 `toml:"concurrency"`
-	DurationTime uint64 `toml:"duration_time"`
-	TotalNum     uint64 `toml:"total_num"`
-	Sleep        uint64 `toml:"sleep"`
+	Name         string             `toml:"name"`
+	Accounts     []WorkerAccount    `toml:"accounts"` // 发送账号，为空时发送至 name 对应的连接
+	Concurrency  uint64             `toml:"concurrency"`
+	DurationTime uint64             `toml:"duration_time"`
+	TotalNum     uint64             `toml:"total_num"`
+	Senders      uint               `toml:"senders"` // 发送协程数，默认 16
+	Adaptive     *AdaptiveConfig    `toml:"adaptive"`
+	Profile      *LoadProfileConfig `toml:"profile"`
+	Capacity     *CapacityConfig    `toml:"capacity"`
+}
+
+// 压测线程的发送账号，每秒发送量按权重分配至匹配的账号，同一账号的多个连接均分该账号的权重
+type WorkerAccount struct {
+	Name   string `toml:"name"`   // {ip}:{port}_{username}，支持通配符，如 127.0.0.1:7890_2000*
+	Weight uint   `toml:"weight"` // 权重，默认 1
+}
+
+// 容量探测：逐级提高每秒发送量，每级校验错误率、响应时间及状态报告延迟，出现不达标后在最后达标与首个不达标速率之间二分查找
+type CapacityConfig struct {
+	Enable           bool    `toml:"enable"`
+	Start            uint64  `toml:"start"`              // 初始每秒发送量，默认 concurrency
+	Step             uint64  `toml:"step"`               // 每级增加的每秒发送量，默认 start
+	Max              uint64  `toml:"max"`                // 最高每秒发送量，默认 start 的 100 倍
+	StepDuration     uint    `toml:"step_duration"`      // 每级持续时间，单位秒，默认 30
+	Cooldown         uint    `toml:"cooldown"`           // 每级之间暂停发送的时间，单位秒，默认 5
+	Precision        uint64  `toml:"precision"`          // 二分查找精度，默认 step 的 1/10
+	MaxErrorRate     float64 `toml:"max_error_rate"`     // 提交包最大失败比例（错误码及超时），默认 0.01
+	MaxLatency       uint    `toml:"max_latency"`        // SubmitResp 平均响应时间上限，单位毫秒，0 表示不限制
+	MaxReportLatency uint    `toml:"max_report_latency"` // 状态报告平均延迟上限，单位毫秒，0 表示不限制
+	MinAchieved      float64 `toml:"min_achieved"`       // 每秒成功数不低于目标速率的比例，默认 0.9
+}
+
+// 负载曲线，按开始后的时间计算每秒发送量；spike、wave 以 concurrency 为基准速率
+type LoadProfileConfig struct {
+	Type string `toml:"type"` // ramp、step、spike、wave
+
+	// ramp：duration 秒内从 from 线性变化到 to，保持 hold 秒后在 down 秒内回到 from（down 为 0 时一直保持 to）
+	From     uint64 `toml:"from"`
+	To       uint64 `toml:"to"`
+	Duration uint   `toml:"duration"`
+	Hold     uint   `toml:"hold"`
+	Down     uint   `toml:"down"`
+
+	// step：依次按每级速率保持指定时间，最后一级结束后保持最后一级速率
+	Steps []LoadStep `toml:"steps"`
+
+	// spike：开始后 spike_at 秒突增到 spike_rate 并保持 spike_duration 秒，spike_interval 不为 0 时按该间隔重复
+	SpikeRate     uint64 `toml:"spike_rate"`
+	SpikeAt       uint   `toml:"spike_at"`
+	SpikeDuration uint   `toml:"spike_duration"`
+	SpikeInterval uint   `toml:"spike_interval"`
+
+	// wave：以 period 秒为周期在 concurrency ± amplitude 之间按正弦变化，从波谷开始
+	Amplitude uint64 `toml:"amplitude"`
+	Period    uint   `toml:"period"`
+}
+
+type LoadStep struct {
+	Rate uint64 `toml:"rate"`
+	Hold uint   `toml:"hold"` // 保持时间，单位秒
+}
+
+// 自适应发送速率（AIMD）：出现流量控制、超时或响应时间过长时按比例降低速率，否则逐步提高
+type AdaptiveConfig struct {
+	Enable     bool    `toml:"enable"`
+	MinRate    uint64  `toml:"min_rate"`    // 最低每秒发送量，默认 1
+	MaxRate    uint64  `toml:"max_rate"`    // 最高每秒发送量，默认 concurrency 的 10 倍
+	Increase   uint64  `toml:"increase"`    // 每个周期增加的每秒发送量，默认 concurrency 的 1/10
+	Decrease   float64 `toml:"decrease"`    // 降速比例，默认 0.5
+	MaxLatency uint    `toml:"max_latency"` // SubmitResp 平均响应时间上限，单位毫秒，0 表示不限制
+	Interval   uint    `toml:"interval"`    // 调整周期，单位秒，默认 1
+}
+
+type PhonePrefix struct {
+	Prefix string `toml:"prefix"`
+	Weight uint   `toml:"weight"`
+}
+
+// 手机号生成器，启用后替换短信中配置的手机号
+type PhoneGeneratorConfig struct {
+	Enable   bool           `toml:"enable"`
+	Type     string         `toml:"type"`     // range、prefix、file
+	Start    uint64         `toml:"start"`    // range: 起始号码
+	End      uint64         `toml:"end"`      // range: 结束号码（含）
+	Random   bool           `toml:"random"`   // range: 随机取号，默认顺序取号
+	Length   int            `toml:"length"`   // prefix: 号码总长度，默认 11
+	Prefixes *[]PhonePrefix `toml:"prefixes"` // prefix: 号段及权重
+	File     string         `toml:"file"`     // file: 号码文件，每行一个号码或 CSV
+	Column   int            `toml:"column"`   // file: CSV 中号码所在列，从 0 开始
+	Loop     bool           `toml:"loop"`     // file: 读完后从头循环
 }
 
 type StressTestConfig struct {
-	Enable   bool                `toml:"enable"`
-	Workers  *[]StressTestWorker `toml:"workers"`
-	Messages *[]TextMessages     `toml:"messages"`
+	Enable      bool                  `toml:"enable"`
+	Workers     *[]StressTestWorker   `toml:"workers"`
+	Messages    *[]TextMessages       `toml:"messages"`
+	MessageFile *MessageFileConfig    `toml:"message_file"`
+	Phones      *PhoneGeneratorConfig `toml:"phones"`
+	Scenario    *ScenarioConfig       `toml:"scenario"`
+	Distributed *DistributedConfig    `toml:"distributed"`
+	Mix         *WorkloadMixConfig    `toml:"mix"`
+	Replay      *ReplayConfig         `toml:"replay"`
+	AutoExit    bool                  `toml:"auto_exit"`    // 压测线程（或场景）全部结束后自动退出
+	WaitTimeout uint                  `toml:"wait_timeout"` // 自动退出前等待 SubmitResp 及状态报告的最长时间，单位秒，默认 300
+}
+
+// 混合负载：按占比发送多种类型的短信，启用后替代 messages、message_file
+type WorkloadMixConfig struct {
+	Enable bool          `toml:"enable"`
+	Items  []WorkloadMix `toml:"items"`
+}
+
+type WorkloadMix struct {
+	Type     string `toml:"type"`     // short、long、group、mo、query
+	Ratio    uint   `toml:"ratio"`    // 占比权重
+	Content  string `toml:"content"`  // 内容模板，默认按类型生成；query 为查询的业务代码，为空时查询总数
+	Phone    string `toml:"phone"`    // 手机号模板，默认 139{{rand_digits:8}}
+	DestNum  int    `toml:"dest_num"` // group：每条群发的号码数，默认 10，最多 100
+	Extend   string `toml:"extend"`
+	Encoding string `toml:"encoding"`
+}
+
+// 流量回放：按文件中每条记录的时间偏移发送，保持原始发送间隔，启用后 workers 不自动启动
+type ReplayConfig struct {
+	Enable   bool            `toml:"enable"`
+	File     string          `toml:"file"`
+	Format   string          `toml:"format"`   // csv、jsonl，默认按文件后缀判断
+	Speed    float64         `toml:"speed"`    // 回放速度倍数，2.0 表示发送间隔缩短为一半，默认 1.0
+	Loop     bool            `toml:"loop"`     // 读完后从头循环，时间偏移接续上一轮
+	LoopGap  uint            `toml:"loop_gap"` // 循环时上一轮最后一条与下一轮第一条的间隔，单位毫秒，默认为上一轮的平均间隔
+	Duration uint            `toml:"duration"` // 最长回放时间，单位秒，0 表示不限制
+	Senders  uint            `toml:"senders"`  // 发送协程数，默认 16
+	Accounts []WorkerAccount `toml:"accounts"` // 未指定 account 的记录发送至这些账号，默认全部账号
+}
+
+// 分布式压测：coordinator 将压测线程按 agent 数均分速率后下发，各 agent 同时启动，结束后合并统计
+type DistributedConfig struct {
+	Mode       string   `toml:"mode"`        // coordinator、agent，为空时不启用
+	Listen     string   `toml:"listen"`      // agent：HTTP 监听地址，默认 127.0.0.1:9100
+	Agents     []string `toml:"agents"`      // coordinator：agent 地址，如 http://127.0.0.1:9100
+	StartDelay uint     `toml:"start_delay"` // coordinator：下发后延迟启动的时间，用于各 agent 同时开始，单位毫秒，默认 2000
+	Timeout    uint     `toml:"timeout"`     // coordinator：等待 agent 结束的最长时间，单位秒，0 表示不限制
+}
+
+// 分布式压测模式，未启用时为空
+func (c *StressTestConfig) DistributedMode() string {
+	if c == nil || !c.Enable || c.Distributed == nil {
+		return ""
+	}
+	return c.Distributed.Mode
+}
+
+// 是否按场景执行，启用时 workers 不自动启动，客户端由 connect 阶段连接
+func (c *StressTestConfig) ScenarioEnabled() bool {
+	return c != nil && c.Enable && c.Scenario != nil && c.Scenario.Enable
 }
 
 type RedisConfig struct {
@@ -43,6 +203,19 @@ type Config struct {
 	StressTest   *StressTestConfig `toml:"stress_test"`
 	Log          *log.Config       `toml:"log"`
 	Redis        *RedisConfig      `toml:"redis"`
+	Assertions   *AssertionConfig  `toml:"assertions"`
+}
+
+// 结束时校验的压测结果阈值，任一项不通过时进程以非 0 状态码退出；阈值为 0 时不校验该项
+type AssertionConfig struct {
+	Enable               bool    `toml:"enable"`
+	MinTps               uint    `toml:"min_tps"`                 // 最低平均每秒发送量
+	MaxSubmitErrorRate   float64 `toml:"max_submit_error_rate"`   // 提交包最大失败比例，0~1
+	MaxMissingReportRate float64 `toml:"max_missing_report_rate"` // 状态报告最大缺失比例，0~1
+	MaxSubmitP99         uint    `toml:"max_submit_p99"`          // SubmitResp 响应时间 P99 上限，单位毫秒
+	MaxReportP99         uint    `toml:"max_report_p99"`          // 状态报告延迟 P99 上限，单位毫秒
+	MaxMixDeviation      float64 `toml:"max_mix_deviation"`       // 混合负载各类型实际占比与目标占比的最大偏差，0~1
+	File                 string  `toml:"file"`                    // 结果文件，默认 CMPP_Stress_Test_Verdict.json
 }
 
 var ConfigObj Config
@@ -56,6 +229,9 @@ func Init() error {
 	if _, err := toml.DecodeFile(*cfgFile, &ConfigObj); err != nil {
 		return err
 	}
+	if err := loadScenario(ConfigObj.StressTest); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"errors"
+
+	"github.com/BurntSushi/toml"
+)
+
+// 多阶段压测场景，按顺序执行各阶段
+type ScenarioConfig struct {
+	Enable bool            `toml:"enable"`
+	File   string          `toml:"file"` // 场景文件，配置后从该文件读取 name 及 phases
+	Name   string          `toml:"name"`
+	Phases []ScenarioPhase `toml:"phases"`
+}
+
+type ScenarioPhase struct {
+	Name     string             `toml:"name"`
+	Action   string             `toml:"action"`   // connect、run、pause、wait_reports、server、disconnect
+	Accounts []string           `toml:"accounts"` // connect、disconnect：账号 {ip}:{port}_{username}（支持通配符），为空时为全部账号
+	Workers  []StressTestWorker `toml:"workers"`  // run：本阶段的压测线程，全部结束后进入下一阶段
+	Duration uint               `toml:"duration"` // pause：暂停时间，单位秒
+	Timeout  uint               `toml:"timeout"`  // wait_reports：最长等待时间，单位秒，默认 300
+	Server   *ServerBehavior    `toml:"server"`   // server：服务端模拟行为
+}
+
+// 从场景文件读取阶段配置
+func loadScenario(cfg *StressTestConfig) error {
+	if cfg == nil || cfg.Scenario == nil || cfg.Scenario.File == "" {
+		return nil
+	}
+	var scenario ScenarioConfig
+	if _, err := toml.DecodeFile(cfg.Scenario.File, &scenario); err != nil {
+		return err
+	}
+	if len(scenario.Phases) == 0 {
+		return errors.New("scenario file has no phases")
+	}
+	cfg.Scenario.Name = scenario.Name
+	cfg.Scenario.Phases = scenario.Phases
+	return nil
+}
@@ -16,4 +16,25 @@ type CmppServerConfig struct {
 	MaxNoRspPkgs    uint              `toml:"max_no_resp_pkgs"`
 	Auths           *[]CmppServerAuth `toml:"auths"`
 	DeliverInterval uint8             `toml:"deliver_interval"` // 回执发送间隔时间
+	Mo              *MockMoConfig     `toml:"mo"`
+	Behavior        *ServerBehavior   `toml:"behavior"`
+}
+
+// 服务端模拟行为，可在场景 server 阶段动态调整
+type ServerBehavior struct {
+	SubmitResult    uint32  `toml:"submit_result"`     // 注入的 SubmitResp 错误码，默认 8（流量控制）
+	SubmitErrorRate float64 `toml:"submit_error_rate"` // SubmitResp 返回错误码的比例，0~1
+	SubmitDelay     uint    `toml:"submit_delay"`      // SubmitResp 延迟，单位毫秒
+	ReportStat      string  `toml:"report_stat"`       // 回执状态，默认 DELIVRD
+	ReportDropRate  float64 `toml:"report_drop_rate"`  // 不推送回执的比例，0~1
+	ReportDelay     uint    `toml:"report_delay"`      // 回执延迟，单位毫秒
+}
+
+// 模拟上行短信，定时向每个已连接的客户端推送
+type MockMoConfig struct {
+	Enable   bool     `toml:"enable"`
+	Interval uint     `toml:"interval"` // 推送间隔，单位毫秒
+	Phone    string   `toml:"phone"`    // 上行手机号，支持模板变量
+	Contents []string `toml:"contents"` // 上行内容，支持模板变量，每次随机选择一条
+	Extend   string   `toml:"extend"`   // 扩展码，拼接在 sp_code 之后
 }
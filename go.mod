@@ -4,6 +4,7 @@ go 1.16
 
 require (
 	github.com/BurntSushi/toml v0.3.1
+	// 固定版本：cmpp/pkg/cmpp_query.go 通过反射替换 Client 未导出的 conn 字段以拦截 CMPP_QUERY，升级前需确认该字段仍为 *Conn
 	github.com/bigwhite/gocmpp v0.0.0-20200715060927-0f5a658fda5e
 	github.com/go-echarts/go-echarts v1.0.0 // indirect
 	github.com/go-echarts/go-echarts/v2 v2.2.4
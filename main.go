@@ -22,6 +22,8 @@ type Service interface {
 	Stop() error
 }
 
+var stressTest = new(stress_test_service.StressTest)
+
 var Services = []Service{
 	// 收集数据服务
 	new(statistics.Collection),
@@ -30,7 +32,7 @@ var Services = []Service{
 	// CMPP 客户端
 	new(client.CmppClient),
 	// 压测服务
-	new(stress_test_service.StressTest),
+	stressTest,
 }
 
 func Init() error {
@@ -54,8 +56,10 @@ func Start() error {
 	return nil
 }
 
+// 逆序停止：先停止压测，再排空客户端，最后关闭服务端并输出统计
 func Stop() error {
-	for i, service := range Services {
+	for i := len(Services) - 1; i >= 0; i-- {
+		service := Services[i]
 		if err := service.Stop(); err != nil {
 			log.Logger.Panic("Stop Failed.",
 				zap.Int("Index", i),
@@ -79,13 +83,23 @@ func main() {
 
 	log.Logger.Info("Start Success.")
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, os.Kill, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
-	<-quit
-
-	log.Logger.Info("Got Signal. Exit.")
+	select {
+	case <-quit:
+		log.Logger.Info("Got Signal. Exit.")
+	case <-stressTest.Done():
+		log.Logger.Info("Stress Test Complete. Exit.")
+	}
 	if err := Stop(); err != nil {
 		log.Logger.Panic("Stop Error.", zap.Error(err))
 		return
 	}
+
+	// 结果校验不通过时以非 0 状态码退出，用于 CI 判断
+	if v := statistics.CollectService.Verdict; v != nil && !v.Passed {
+		log.Logger.Error("Verdict Failed. Exit.")
+		_ = log.Logger.Sync()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,35 @@
+package statistics
+
+import "sync"
+
+// 自适应发送速率结果
+type AdaptiveStatistics struct {
+	lock    sync.Mutex
+	results []AdaptiveResult
+}
+
+type AdaptiveResult struct {
+	Name          string `json:"name"`
+	FinalRate     uint64 `json:"final_rate"`
+	PeakSustained uint64 `json:"peak_sustained"` // 未降速周期内网关实际处理的最高每秒成功数
+	AvgAchieved   uint64 `json:"avg_achieved"`   // 平均每秒成功数
+	Backoffs      uint64 `json:"backoffs"`       // 降速次数
+}
+
+func (s *AdaptiveStatistics) Add(r AdaptiveResult) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results = append(s.results, r)
+}
+
+func (s *AdaptiveStatistics) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results = nil
+}
+
+func (s *AdaptiveStatistics) Summary() []AdaptiveResult {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]AdaptiveResult{}, s.results...)
+}
@@ -0,0 +1,42 @@
+package statistics
+
+import "sync"
+
+// 容量探测结果
+type CapacityStatistics struct {
+	lock    sync.Mutex
+	results []CapacityResult
+}
+
+type CapacityResult struct {
+	Name     string         `json:"name"`
+	Capacity uint64         `json:"capacity"` // 达标的最高每秒发送量，0 表示初始速率即不达标
+	Steps    []CapacityStep `json:"steps"`    // 按执行顺序的每级测量结果
+}
+
+type CapacityStep struct {
+	Rate            uint64  `json:"rate"`
+	Achieved        float64 `json:"achieved"` // 每秒成功数
+	ErrorRate       float64 `json:"error_rate"`
+	LatencyMs       float64 `json:"latency_ms"`
+	ReportLatencyMs float64 `json:"report_latency_ms"`
+	Passed          bool    `json:"passed"`
+}
+
+func (s *CapacityStatistics) Add(r CapacityResult) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results = append(s.results, r)
+}
+
+func (s *CapacityStatistics) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results = nil
+}
+
+func (s *CapacityStatistics) Summary() []CapacityResult {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]CapacityResult{}, s.results...)
+}
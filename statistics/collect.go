@@ -36,6 +36,15 @@ type Collection struct {
 	cancel      context.CancelFunc
 	Logger      *zap.Logger
 	Service     CollectionService
+	Reports     *ReportTracker
+	Submits     *SubmitStatistics
+	Mos         *MoStatistics
+	Heartbeats  *HeartbeatStatistics
+	Workers     *WorkerStatistics
+	Capacity    *CapacityStatistics
+	Adaptive    *AdaptiveStatistics
+	Mix         *MixStatistics
+	Verdict     *Verdict // 启用结果校验时，结束后的校验结果
 	TickerCount int
 }
 
@@ -44,6 +53,14 @@ var CollectService *Collection
 func (s *Collection) Init(log *zap.Logger) {
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 	s.Logger = log
+	s.Reports = NewReportTracker()
+	s.Submits = &SubmitStatistics{}
+	s.Mos = &MoStatistics{}
+	s.Heartbeats = &HeartbeatStatistics{}
+	s.Workers = &WorkerStatistics{}
+	s.Capacity = &CapacityStatistics{}
+	s.Adaptive = &AdaptiveStatistics{}
+	s.Mix = &MixStatistics{}
 	s.cfg = config.ConfigObj.Redis
 	if s.cfg.Enable {
 		s.Service = CollectionService(new(RedisStatistics))
@@ -54,6 +71,19 @@ func (s *Collection) Init(log *zap.Logger) {
 	CollectService = s
 }
 
+// 清空压测结果统计（不含机器及数据包的时间序列），agent 开始新一次压测前调用，避免汇总上一次的结果
+func (s *Collection) Reset() {
+	s.Reports.Reset()
+	s.Submits.Reset()
+	s.Mos.Reset()
+	s.Heartbeats.Reset()
+	s.Workers.Reset()
+	s.Capacity.Reset()
+	s.Adaptive.Reset()
+	s.Mix.Reset()
+	s.Verdict = nil
+}
+
 func (s *Collection) Start() error {
 	if err := s.Service.Start(); err != nil {
 		s.Logger.Error("Collect Service Start Error.", zap.Error(err))
@@ -65,6 +95,7 @@ func (s *Collection) Start() error {
 
 func (s *Collection) Stop() error {
 	s.Graph()
+	s.ClientSummary()
 	if err := s.Service.Stop(); err != nil {
 		s.Logger.Error("Collect Service Stop Error.", zap.Error(err))
 	}
@@ -118,6 +149,109 @@ func (s *Collection) SavePackerStatistics(tickerCount int) {
 	}
 }
 
+// 输出客户端提交超时重发统计、状态报告对账结果、上行短信及心跳统计
+// 分布式 coordinator 不发送短信，报告由合并后的 agent 统计输出并校验
+func (s *Collection) ClientSummary() {
+	if !config.ConfigObj.ClientConfig.Enable {
+		return
+	}
+	if config.ConfigObj.StressTest.DistributedMode() == "coordinator" {
+		return
+	}
+	summary := s.Summary()
+	s.LogSummary(summary)
+	if err := summary.WriteFile(clientSummaryFile); err != nil {
+		s.Logger.Error("[Collect][ClientSummary] Write Error", zap.Error(err))
+	}
+	s.Assert(summary)
+}
+
+func (s *Collection) Summary() *ClientSummary {
+	return &ClientSummary{
+		Submit:    s.Submits.Summary(),
+		Report:    s.Reports.Summary(),
+		Mo:        s.Mos.Summary(),
+		Heartbeat: s.Heartbeats.Summary(),
+		Workers:   s.Workers.Summary(),
+		Capacity:  s.Capacity.Summary(),
+		Adaptive:  s.Adaptive.Summary(),
+		Mix:       s.Mix.Summary(),
+	}
+}
+
+func (s *Collection) LogSummary(summary *ClientSummary) {
+	s.Logger.Info("[Collect][WorkerSummary]",
+		zap.Uint64("Sent", summary.Workers.Sent),
+		zap.Float64("Achieved", summary.Workers.Achieved))
+	s.Logger.Info("[Collect][SubmitSummary]",
+		zap.Uint64("Sent", summary.Submit.Sent),
+		zap.Uint64("Success", summary.Submit.Success),
+		zap.Float64("ErrorRate", summary.Submit.ErrorRate),
+		zap.Float64("P99Ms", summary.Submit.Latency.P99Ms),
+		zap.Uint64("Timeout", summary.Submit.Timeout),
+		zap.Uint64("Resend", summary.Submit.Resend),
+		zap.Uint64("Failed", summary.Submit.Failed),
+		zap.Any("Results", summary.Submit.Results))
+	s.Logger.Info("[Collect][ReportSummary]",
+		zap.Uint64("Expected", summary.Report.Expected),
+		zap.Uint64("Matched", summary.Report.Matched),
+		zap.Uint64("Missing", summary.Report.Missing),
+		zap.Uint64("Duplicate", summary.Report.Duplicate),
+		zap.Uint64("Orphan", summary.Report.Orphan),
+		zap.Float64("MissingRate", summary.Report.MissingRate),
+		zap.Float64("P99Ms", summary.Report.Latency.P99Ms),
+		zap.Any("Stats", summary.Report.Stats))
+	s.Logger.Info("[Collect][MoSummary]",
+		zap.Uint64("Received", summary.Mo.Received),
+		zap.Uint64("Replied", summary.Mo.Replied))
+	s.Logger.Info("[Collect][HeartbeatSummary]",
+		zap.Uint64("Sent", summary.Heartbeat.Sent),
+		zap.Uint64("Resp", summary.Heartbeat.Resp),
+		zap.Uint64("NoResp", summary.Heartbeat.NoResp),
+		zap.Uint64("Reconnect", summary.Heartbeat.Reconnect),
+		zap.Float64("RttAvgMs", summary.Heartbeat.RttAvgMs),
+		zap.Float64("RttMaxMs", summary.Heartbeat.RttMaxMs))
+	if summary.Mix != nil {
+		for _, t := range summary.Mix.Types {
+			s.Logger.Info("[Collect][MixSummary]",
+				zap.String("Type", t.Type),
+				zap.Float64("TargetRatio", t.TargetRatio),
+				zap.Float64("Ratio", t.Ratio),
+				zap.Uint64("Messages", t.Messages),
+				zap.Uint64("Packets", t.Packets),
+				zap.Uint64("Destinations", t.Destinations),
+				zap.Uint64("Reports", t.Reports))
+		}
+		s.Logger.Info("[Collect][MixSummary]", zap.Float64("MaxDeviation", summary.Mix.MaxDeviation))
+	}
+}
+
+// 按配置的阈值校验压测结果并输出至文件
+func (s *Collection) Assert(summary *ClientSummary) {
+	cfg := config.ConfigObj.Assertions
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	s.Verdict = Evaluate(cfg, summary)
+	for _, c := range s.Verdict.Checks {
+		if c.Passed {
+			s.Logger.Info("[Collect][Assert] Passed",
+				zap.String("Name", c.Name),
+				zap.Float64("Actual", c.Actual),
+				zap.Float64("Limit", c.Limit))
+		} else {
+			s.Logger.Error("[Collect][Assert] Failed",
+				zap.String("Name", c.Name),
+				zap.Float64("Actual", c.Actual),
+				zap.Float64("Limit", c.Limit))
+		}
+	}
+	s.Logger.Info("[Collect][Verdict]", zap.Bool("Passed", s.Verdict.Passed))
+	if err := s.Verdict.WriteFile(cfg.File); err != nil {
+		s.Logger.Error("[Collect][Verdict] Write Error", zap.Error(err))
+	}
+}
+
 func (s *Collection) Graph() {
 	s.GraphMachine()
 	s.GraphPackage()
@@ -0,0 +1,73 @@
+package statistics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 客户端心跳统计，RTT 单位微秒
+type HeartbeatStatistics struct {
+	Sent      uint64 // 发送的心跳数
+	Resp      uint64 // 收到响应的心跳数
+	NoResp    uint64 // 未响应或发送失败的心跳数
+	Reconnect uint64 // 心跳连续未响应导致的重连次数
+	RttSum    uint64
+	RttMax    uint64
+	RttLast   uint64
+}
+
+type HeartbeatSummary struct {
+	Sent      uint64  `json:"sent"`
+	Resp      uint64  `json:"resp"`
+	NoResp    uint64  `json:"no_resp"`
+	Reconnect uint64  `json:"reconnect"`
+	RttAvgMs  float64 `json:"rtt_avg_ms"`
+	RttMaxMs  float64 `json:"rtt_max_ms"`
+	RttLastMs float64 `json:"rtt_last_ms"`
+}
+
+func (s *HeartbeatStatistics) AddSent() {
+	atomic.AddUint64(&s.Sent, 1)
+}
+
+func (s *HeartbeatStatistics) AddNoResp() {
+	atomic.AddUint64(&s.NoResp, 1)
+}
+
+func (s *HeartbeatStatistics) AddReconnect() {
+	atomic.AddUint64(&s.Reconnect, 1)
+}
+
+func (s *HeartbeatStatistics) AddResp(rtt time.Duration) {
+	us := uint64(rtt / time.Microsecond)
+	atomic.AddUint64(&s.Resp, 1)
+	atomic.AddUint64(&s.RttSum, us)
+	atomic.StoreUint64(&s.RttLast, us)
+	for {
+		max := atomic.LoadUint64(&s.RttMax)
+		if us <= max || atomic.CompareAndSwapUint64(&s.RttMax, max, us) {
+			return
+		}
+	}
+}
+
+func (s *HeartbeatStatistics) Reset() {
+	for _, v := range []*uint64{&s.Sent, &s.Resp, &s.NoResp, &s.Reconnect, &s.RttSum, &s.RttMax, &s.RttLast} {
+		atomic.StoreUint64(v, 0)
+	}
+}
+
+func (s *HeartbeatStatistics) Summary() *HeartbeatSummary {
+	summary := &HeartbeatSummary{
+		Sent:      atomic.LoadUint64(&s.Sent),
+		Resp:      atomic.LoadUint64(&s.Resp),
+		NoResp:    atomic.LoadUint64(&s.NoResp),
+		Reconnect: atomic.LoadUint64(&s.Reconnect),
+		RttMaxMs:  float64(atomic.LoadUint64(&s.RttMax)) / 1000,
+		RttLastMs: float64(atomic.LoadUint64(&s.RttLast)) / 1000,
+	}
+	if summary.Resp > 0 {
+		summary.RttAvgMs = float64(atomic.LoadUint64(&s.RttSum)) / float64(summary.Resp) / 1000
+	}
+	return summary
+}
@@ -0,0 +1,123 @@
+package statistics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	latencyGrowth  = 1.05 // 相邻分桶上界之比，分位数误差不超过 5%
+	latencyBuckets = 450  // 覆盖 1us ~ 1h
+)
+
+var latencyLogGrowth = math.Log(latencyGrowth)
+
+// 延迟直方图，单位微秒，按对数分桶；分桶固定，多个直方图可直接合并
+type LatencyHistogram struct {
+	Buckets [latencyBuckets]uint64
+	Count   uint64
+	Sum     uint64
+	Max     uint64
+}
+
+type LatencySummary struct {
+	Count  uint64  `json:"count"`
+	AvgMs  float64 `json:"avg_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+func latencyBucket(us uint64) int {
+	if us <= 1 {
+		return 0
+	}
+	i := int(math.Log(float64(us))/latencyLogGrowth) + 1
+	if i >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return i
+}
+
+// 分桶上界，单位微秒
+func latencyBucketUpper(i int) float64 {
+	return math.Pow(latencyGrowth, float64(i))
+}
+
+func (h *LatencyHistogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	us := uint64(d / time.Microsecond)
+	atomic.AddUint64(&h.Buckets[latencyBucket(us)], 1)
+	atomic.AddUint64(&h.Count, 1)
+	atomic.AddUint64(&h.Sum, us)
+	for {
+		max := atomic.LoadUint64(&h.Max)
+		if us <= max || atomic.CompareAndSwapUint64(&h.Max, max, us) {
+			return
+		}
+	}
+}
+
+// 合并另一个直方图
+func (h *LatencyHistogram) Reset() {
+	for i := range h.Buckets {
+		atomic.StoreUint64(&h.Buckets[i], 0)
+	}
+	atomic.StoreUint64(&h.Count, 0)
+	atomic.StoreUint64(&h.Sum, 0)
+	atomic.StoreUint64(&h.Max, 0)
+}
+
+func (h *LatencyHistogram) Merge(o *LatencyHistogram) {
+	for i := range o.Buckets {
+		if n := atomic.LoadUint64(&o.Buckets[i]); n > 0 {
+			atomic.AddUint64(&h.Buckets[i], n)
+		}
+	}
+	atomic.AddUint64(&h.Count, atomic.LoadUint64(&o.Count))
+	atomic.AddUint64(&h.Sum, atomic.LoadUint64(&o.Sum))
+	if max := atomic.LoadUint64(&o.Max); max > atomic.LoadUint64(&h.Max) {
+		atomic.StoreUint64(&h.Max, max)
+	}
+}
+
+// 分位数，q 取值 0~1，返回所在分桶上界（不超过最大值），单位毫秒
+func (h *LatencyHistogram) QuantileMs(q float64) float64 {
+	count := atomic.LoadUint64(&h.Count)
+	if count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(count)))
+	if rank == 0 {
+		rank = 1
+	}
+	max := float64(atomic.LoadUint64(&h.Max))
+	var seen uint64
+	for i := range h.Buckets {
+		seen += atomic.LoadUint64(&h.Buckets[i])
+		if seen >= rank {
+			return math.Min(latencyBucketUpper(i), max) / 1000
+		}
+	}
+	return max / 1000
+}
+
+func (h *LatencyHistogram) Summary() *LatencySummary {
+	s := &LatencySummary{
+		Count:  atomic.LoadUint64(&h.Count),
+		P50Ms:  h.QuantileMs(0.5),
+		P90Ms:  h.QuantileMs(0.9),
+		P99Ms:  h.QuantileMs(0.99),
+		P999Ms: h.QuantileMs(0.999),
+		MaxMs:  float64(atomic.LoadUint64(&h.Max)) / 1000,
+	}
+	if s.Count > 0 {
+		s.AvgMs = float64(atomic.LoadUint64(&h.Sum)) / float64(s.Count) / 1000
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package statistics
+
+// 统计快照，分布式压测时 agent 返回给 coordinator 合并
+type Snapshot struct {
+	Summary       *ClientSummary    `json:"summary"`
+	SubmitLatency *LatencyHistogram `json:"submit_latency"`
+	ReportLatency *LatencyHistogram `json:"report_latency"`
+}
+
+func (s *Collection) Snapshot() *Snapshot {
+	submit := &LatencyHistogram{}
+	submit.Merge(&s.Submits.Latency)
+	return &Snapshot{
+		Summary:       s.Summary(),
+		SubmitLatency: submit,
+		ReportLatency: s.Reports.Histogram(),
+	}
+}
+
+// 合并多个快照：计数累加，比例重新计算，延迟分位数由合并后的直方图计算
+// 各 agent 同时压测，实际速率为各 agent 之和
+func MergeSnapshots(snapshots []*Snapshot) *ClientSummary {
+	merged := &ClientSummary{
+		Submit:    &SubmitSummary{},
+		Report:    &ReportSummary{Stats: make(map[string]uint64)},
+		Mo:        &MoSummary{},
+		Heartbeat: &HeartbeatSummary{},
+		Workers:   &WorkersSummary{},
+	}
+	submitLatency, reportLatency := &LatencyHistogram{}, &LatencyHistogram{}
+	var rttSum float64
+
+	for _, snap := range snapshots {
+		s := snap.Summary
+		merged.Submit.Sent += s.Submit.Sent
+		merged.Submit.Success += s.Submit.Success
+		merged.Submit.Timeout += s.Submit.Timeout
+		merged.Submit.Resend += s.Submit.Resend
+		merged.Submit.Failed += s.Submit.Failed
+		for result, n := range s.Submit.Results {
+			if merged.Submit.Results == nil {
+				merged.Submit.Results = make(map[string]uint64)
+			}
+			merged.Submit.Results[result] += n
+		}
+
+		merged.Report.Expected += s.Report.Expected
+		merged.Report.Matched += s.Report.Matched
+		merged.Report.Missing += s.Report.Missing
+		merged.Report.Duplicate += s.Report.Duplicate
+		merged.Report.Orphan += s.Report.Orphan
+		for stat, n := range s.Report.Stats {
+			merged.Report.Stats[stat] += n
+		}
+		for _, m := range s.Report.MissingSamples {
+			if len(merged.Report.MissingSamples) >= maxMissingSamples {
+				break
+			}
+			merged.Report.MissingSamples = append(merged.Report.MissingSamples, m)
+		}
+
+		merged.Mo.Received += s.Mo.Received
+		merged.Mo.Replied += s.Mo.Replied
+
+		merged.Heartbeat.Sent += s.Heartbeat.Sent
+		merged.Heartbeat.Resp += s.Heartbeat.Resp
+		merged.Heartbeat.NoResp += s.Heartbeat.NoResp
+		merged.Heartbeat.Reconnect += s.Heartbeat.Reconnect
+		rttSum += s.Heartbeat.RttAvgMs * float64(s.Heartbeat.Resp)
+		if s.Heartbeat.RttMaxMs > merged.Heartbeat.RttMaxMs {
+			merged.Heartbeat.RttMaxMs = s.Heartbeat.RttMaxMs
+		}
+
+		merged.Workers.Sent += s.Workers.Sent
+		merged.Workers.Achieved += s.Workers.Achieved
+		merged.Workers.Workers = append(merged.Workers.Workers, s.Workers.Workers...)
+		merged.Capacity = append(merged.Capacity, s.Capacity...)
+		merged.Adaptive = append(merged.Adaptive, s.Adaptive...)
+		merged.Mix = mergeMix(merged.Mix, s.Mix)
+
+		if snap.SubmitLatency != nil {
+			submitLatency.Merge(snap.SubmitLatency)
+		}
+		if snap.ReportLatency != nil {
+			reportLatency.Merge(snap.ReportLatency)
+		}
+	}
+
+	if merged.Submit.Sent > 0 && merged.Submit.Success < merged.Submit.Sent {
+		merged.Submit.ErrorRate = float64(merged.Submit.Sent-merged.Submit.Success) / float64(merged.Submit.Sent)
+	}
+	if merged.Report.Expected > 0 {
+		merged.Report.MissingRate = float64(merged.Report.Missing) / float64(merged.Report.Expected)
+	}
+	if merged.Heartbeat.Resp > 0 {
+		merged.Heartbeat.RttAvgMs = rttSum / float64(merged.Heartbeat.Resp)
+	}
+	merged.Submit.Latency = submitLatency.Summary()
+	merged.Report.Latency = reportLatency.Summary()
+	return merged
+}
@@ -0,0 +1,128 @@
+package statistics
+
+import (
+	"math"
+	"sync"
+)
+
+// 混合负载统计：按类型统计短信数、提交包数（长短信按分段计）及号码数，用于对比实际占比与目标占比
+type MixStatistics struct {
+	lock  sync.Mutex
+	types []*MixTypeSummary
+}
+
+type MixSummary struct {
+	Messages     uint64           `json:"messages"`
+	MaxDeviation float64          `json:"max_deviation"` // 各类型实际占比与目标占比的最大偏差
+	Types        []MixTypeSummary `json:"types"`
+}
+
+type MixTypeSummary struct {
+	Type         string  `json:"type"`
+	TargetRatio  float64 `json:"target_ratio"`
+	Ratio        float64 `json:"ratio"` // 实际占比（按短信数）
+	Messages     uint64  `json:"messages"`
+	Packets      uint64  `json:"packets"`      // 提交包数，mo 为 0
+	Destinations uint64  `json:"destinations"` // 号码数
+	Reports      uint64  `json:"reports"`      // 应收状态报告数，每个提交包的每个号码一个
+}
+
+// 登记类型及目标占比，按登记顺序输出
+func (s *MixStatistics) SetTarget(typ string, ratio float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.find(typ).TargetRatio = ratio
+}
+
+func (s *MixStatistics) Add(typ string, packets, destinations, reports uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t := s.find(typ)
+	t.Messages++
+	t.Packets += packets
+	t.Destinations += destinations
+	t.Reports += reports
+}
+
+// 清空各类型的计数，保留登记的类型及目标占比
+func (s *MixStatistics) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, t := range s.types {
+		*t = MixTypeSummary{Type: t.Type, TargetRatio: t.TargetRatio}
+	}
+}
+
+func (s *MixStatistics) find(typ string) *MixTypeSummary {
+	for _, t := range s.types {
+		if t.Type == typ {
+			return t
+		}
+	}
+	t := &MixTypeSummary{Type: typ}
+	s.types = append(s.types, t)
+	return t
+}
+
+// 未启用混合负载时返回 nil
+func (s *MixStatistics) Summary() *MixSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.types) == 0 {
+		return nil
+	}
+	summary := &MixSummary{Types: make([]MixTypeSummary, 0, len(s.types))}
+	for _, t := range s.types {
+		summary.Types = append(summary.Types, *t)
+	}
+	summary.calculate()
+	return summary
+}
+
+// 按各类型短信数计算实际占比及最大偏差
+func (s *MixSummary) calculate() {
+	s.Messages = 0
+	for _, t := range s.Types {
+		s.Messages += t.Messages
+	}
+	s.MaxDeviation = 0
+	for i := range s.Types {
+		t := &s.Types[i]
+		t.Ratio = 0
+		if s.Messages > 0 {
+			t.Ratio = float64(t.Messages) / float64(s.Messages)
+		}
+		if d := math.Abs(t.Ratio - t.TargetRatio); d > s.MaxDeviation {
+			s.MaxDeviation = d
+		}
+	}
+}
+
+// 合并多个 agent 的混合负载统计
+func mergeMix(merged, s *MixSummary) *MixSummary {
+	if s == nil {
+		return merged
+	}
+	if merged == nil {
+		merged = &MixSummary{}
+	}
+	for _, t := range s.Types {
+		found := false
+		for i := range merged.Types {
+			m := &merged.Types[i]
+			if m.Type == t.Type {
+				m.Messages += t.Messages
+				m.Packets += t.Packets
+				m.Destinations += t.Destinations
+				m.Reports += t.Reports
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Types = append(merged.Types, t)
+		}
+	}
+	merged.calculate()
+	return merged
+}
@@ -0,0 +1,34 @@
+package statistics
+
+import "sync/atomic"
+
+// 客户端上行短信统计
+type MoStatistics struct {
+	Received uint64 // 收到的上行短信数
+	Replied  uint64 // 自动回复数
+}
+
+type MoSummary struct {
+	Received uint64 `json:"received"`
+	Replied  uint64 `json:"replied"`
+}
+
+func (s *MoStatistics) AddReceived() {
+	atomic.AddUint64(&s.Received, 1)
+}
+
+func (s *MoStatistics) AddReplied() {
+	atomic.AddUint64(&s.Replied, 1)
+}
+
+func (s *MoStatistics) Reset() {
+	atomic.StoreUint64(&s.Received, 0)
+	atomic.StoreUint64(&s.Replied, 0)
+}
+
+func (s *MoStatistics) Summary() *MoSummary {
+	return &MoSummary{
+		Received: atomic.LoadUint64(&s.Received),
+		Replied:  atomic.LoadUint64(&s.Replied),
+	}
+}
@@ -0,0 +1,256 @@
+package statistics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const maxMissingSamples = 1000
+
+// 已匹配的状态报告保留 receivedTTL 或最多 maxReceived 个，用于识别重复的状态报告，
+// 超出后按匹配顺序移除，之后收到的重复状态报告记为孤儿报告
+const (
+	receivedTTL = 10 * time.Minute
+	maxReceived = 1000000
+)
+
+// 孤儿报告保留 orphanTTL 或最多 maxOrphans 个（含已转为匹配、尚未移出顺序列表的），等待 SubmitResp 到达后转为匹配，
+// 超出后按收到顺序移除，只计入孤儿报告数，之后收到的重复状态报告再次记为孤儿报告
+const (
+	orphanTTL  = 10 * time.Minute
+	maxOrphans = 100000
+)
+
+type ReportResult int
+
+const (
+	ReportMatched   ReportResult = iota // 与已提交短信匹配
+	ReportDuplicate                     // 重复的状态报告
+	ReportOrphan                        // 未知 MsgId 或号码的状态报告
+)
+
+func (r ReportResult) String() string {
+	switch r {
+	case ReportMatched:
+		return "Matched"
+	case ReportDuplicate:
+		return "Duplicate"
+	}
+	return "Orphan"
+}
+
+// 状态报告按 MsgId + 接收号码 匹配
+type reportKey struct {
+	MsgId uint64
+	Phone string
+}
+
+// 客户端状态报告对账：提交成功且需要状态报告的短信登记后等待状态报告
+// 状态报告可能先于 SubmitResp 到达，此时先记为孤儿报告，登记时再转为匹配
+// 状态报告延迟为提交包发送至收到状态报告的时间
+type ReportTracker struct {
+	lock        sync.Mutex
+	pending     map[reportKey]time.Time
+	received    map[reportKey]time.Time
+	order       []reportKey // 按匹配顺序排列的 received，head 之前的已移除
+	head        int
+	orphans     map[reportKey]orphanReport
+	orphanOrder []reportKey // 按收到顺序排列的 orphans，orphanHead 之前的已移除
+	orphanHead  int
+	expired     uint64 // 超出保留时长或个数上限后移除的孤儿报告数
+	expected    uint64
+	matched     uint64
+	duplicate   uint64
+	stats       map[string]uint64
+	latency     LatencyHistogram
+}
+
+type orphanReport struct {
+	stat string
+	at   time.Time
+}
+
+// 对账结果
+type ReportSummary struct {
+	Expected       uint64            `json:"expected"`
+	Matched        uint64            `json:"matched"`
+	Missing        uint64            `json:"missing"`
+	Duplicate      uint64            `json:"duplicate"`
+	Orphan         uint64            `json:"orphan"`
+	MissingRate    float64           `json:"missing_rate"`
+	Stats          map[string]uint64 `json:"stats"`
+	Latency        *LatencySummary   `json:"latency"`
+	MissingSamples []MissingReport   `json:"missing_samples,omitempty"`
+}
+
+type MissingReport struct {
+	MsgId uint64 `json:"msg_id"`
+	Phone string `json:"phone"`
+}
+
+func NewReportTracker() *ReportTracker {
+	return &ReportTracker{
+		pending:  make(map[reportKey]time.Time),
+		received: make(map[reportKey]time.Time),
+		orphans:  make(map[reportKey]orphanReport),
+		stats:    make(map[string]uint64),
+	}
+}
+
+// 清空全部记录
+func (t *ReportTracker) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending = make(map[reportKey]time.Time)
+	t.received = make(map[reportKey]time.Time)
+	t.order, t.head = nil, 0
+	t.orphans = make(map[reportKey]orphanReport)
+	t.orphanOrder, t.orphanHead, t.expired = nil, 0, 0
+	t.expected, t.matched, t.duplicate = 0, 0, 0
+	t.stats = make(map[string]uint64)
+	t.latency.Reset()
+}
+
+// 登记等待状态报告的短信，返回其中已提前收到状态报告的号码数
+func (t *ReportTracker) Submitted(msgId uint64, phones []string, sendTime time.Time) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	early := 0
+	for _, phone := range phones {
+		key := reportKey{MsgId: msgId, Phone: phone}
+		if _, ok := t.pending[key]; ok {
+			continue
+		}
+		if _, ok := t.received[key]; ok {
+			continue
+		}
+		t.expected++
+		if orphan, ok := t.orphans[key]; ok {
+			delete(t.orphans, key)
+			t.markReceived(key)
+			t.matched++
+			t.stats[orphan.stat]++
+			t.latency.Record(orphan.at.Sub(sendTime))
+			early++
+			continue
+		}
+		t.pending[key] = sendTime
+	}
+	return early
+}
+
+// 收到状态报告，匹配时返回状态报告延迟
+func (t *ReportTracker) Received(msgId uint64, phone, stat string) (ReportResult, time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := reportKey{MsgId: msgId, Phone: phone}
+	if sendTime, ok := t.pending[key]; ok {
+		delete(t.pending, key)
+		t.markReceived(key)
+		t.matched++
+		t.stats[stat]++
+		latency := time.Since(sendTime)
+		t.latency.Record(latency)
+		return ReportMatched, latency
+	}
+	if _, ok := t.received[key]; ok {
+		t.duplicate++
+		return ReportDuplicate, 0
+	}
+	if _, ok := t.orphans[key]; ok {
+		t.duplicate++
+		return ReportDuplicate, 0
+	}
+	now := time.Now()
+	t.orphans[key] = orphanReport{stat: stat, at: now}
+	t.orphanOrder = append(t.orphanOrder, key)
+	t.expireOrphans(now)
+	return ReportOrphan, 0
+}
+
+// 移除超过保留时长或个数上限的孤儿报告，已转为匹配的跳过，移除过半时压缩 orphanOrder
+func (t *ReportTracker) expireOrphans(now time.Time) {
+	for t.orphanHead < len(t.orphanOrder) {
+		key := t.orphanOrder[t.orphanHead]
+		if orphan, ok := t.orphans[key]; ok {
+			if len(t.orphanOrder)-t.orphanHead <= maxOrphans && now.Sub(orphan.at) < orphanTTL {
+				break
+			}
+			delete(t.orphans, key)
+			t.expired++
+		}
+		t.orphanHead++
+	}
+	if t.orphanHead > 1024 && t.orphanHead*2 > len(t.orphanOrder) {
+		n := copy(t.orphanOrder, t.orphanOrder[t.orphanHead:])
+		t.orphanOrder = t.orphanOrder[:n]
+		t.orphanHead = 0
+	}
+}
+
+func (t *ReportTracker) markReceived(key reportKey) {
+	now := time.Now()
+	t.received[key] = now
+	t.order = append(t.order, key)
+	t.expireReceived(now)
+}
+
+// 移除超过保留时长或个数上限的已匹配记录，移除过半时压缩 order
+func (t *ReportTracker) expireReceived(now time.Time) {
+	for t.head < len(t.order) {
+		key := t.order[t.head]
+		if len(t.received) <= maxReceived && now.Sub(t.received[key]) < receivedTTL {
+			break
+		}
+		delete(t.received, key)
+		t.head++
+	}
+	if t.head > 1024 && t.head*2 > len(t.order) {
+		n := copy(t.order, t.order[t.head:])
+		t.order = t.order[:n]
+		t.head = 0
+	}
+}
+
+func (t *ReportTracker) Summary() *ReportSummary {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	s := &ReportSummary{
+		Expected:  t.expected,
+		Matched:   t.matched,
+		Missing:   uint64(len(t.pending)),
+		Duplicate: t.duplicate,
+		Orphan:    t.expired + uint64(len(t.orphans)),
+		Stats:     make(map[string]uint64, len(t.stats)),
+		Latency:   t.latency.Summary(),
+	}
+	if s.Expected > 0 {
+		s.MissingRate = float64(s.Missing) / float64(s.Expected)
+	}
+	for stat, n := range t.stats {
+		s.Stats[stat] = n
+	}
+	for key := range t.pending {
+		if len(s.MissingSamples) >= maxMissingSamples {
+			break
+		}
+		s.MissingSamples = append(s.MissingSamples, MissingReport{MsgId: key.MsgId, Phone: key.Phone})
+	}
+	sort.Slice(s.MissingSamples, func(i, j int) bool {
+		return s.MissingSamples[i].MsgId < s.MissingSamples[j].MsgId
+	})
+	return s
+}
+
+// 状态报告延迟直方图快照
+func (t *ReportTracker) Histogram() *LatencyHistogram {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	h := &LatencyHistogram{}
+	h.Merge(&t.latency)
+	return h
+}
@@ -0,0 +1,99 @@
+package statistics
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 客户端提交包统计，重发的提交包只计一次
+type SubmitStatistics struct {
+	Sent    uint64 // 提交包数
+	Success uint64 // 最终返回 Result 0 的提交包数
+	Timeout uint64 // 等待 SubmitResp 超时次数
+	Resend  uint64 // 重发次数
+	Failed  uint64 // 最终未成功的提交包数：达到最大发送次数仍超时、最终返回非 0 Result
+	Latency LatencyHistogram
+
+	lock    sync.Mutex
+	results map[uint32]uint64 // 最终返回的非 0 Result 及提交包数
+}
+
+type SubmitSummary struct {
+	Sent      uint64            `json:"sent"`
+	Success   uint64            `json:"success"`
+	ErrorRate float64           `json:"error_rate"` // 未成功（错误码、超时及未响应）的提交包比例
+	Timeout   uint64            `json:"timeout"`
+	Resend    uint64            `json:"resend"`
+	Failed    uint64            `json:"failed"`
+	Results   map[string]uint64 `json:"results,omitempty"` // 最终失败的 Result 及提交包数
+	Latency   *LatencySummary   `json:"latency"`           // 成功提交包的 SubmitResp 响应时间
+}
+
+func (s *SubmitStatistics) AddSent() {
+	atomic.AddUint64(&s.Sent, 1)
+}
+
+func (s *SubmitStatistics) AddSuccess(latency time.Duration) {
+	atomic.AddUint64(&s.Success, 1)
+	s.Latency.Record(latency)
+}
+
+func (s *SubmitStatistics) AddTimeout() {
+	atomic.AddUint64(&s.Timeout, 1)
+}
+
+func (s *SubmitStatistics) AddResend() {
+	atomic.AddUint64(&s.Resend, 1)
+}
+
+func (s *SubmitStatistics) AddFailed() {
+	atomic.AddUint64(&s.Failed, 1)
+}
+
+// 最终返回非 0 Result 的提交包，计入失败数并按 Result 分类统计
+func (s *SubmitStatistics) AddFailedResult(result uint32) {
+	atomic.AddUint64(&s.Failed, 1)
+	s.lock.Lock()
+	if s.results == nil {
+		s.results = make(map[uint32]uint64)
+	}
+	s.results[result]++
+	s.lock.Unlock()
+}
+
+func (s *SubmitStatistics) Reset() {
+	atomic.StoreUint64(&s.Sent, 0)
+	atomic.StoreUint64(&s.Success, 0)
+	atomic.StoreUint64(&s.Timeout, 0)
+	atomic.StoreUint64(&s.Resend, 0)
+	atomic.StoreUint64(&s.Failed, 0)
+	s.Latency.Reset()
+	s.lock.Lock()
+	s.results = nil
+	s.lock.Unlock()
+}
+
+func (s *SubmitStatistics) Summary() *SubmitSummary {
+	summary := &SubmitSummary{
+		Sent:    atomic.LoadUint64(&s.Sent),
+		Success: atomic.LoadUint64(&s.Success),
+		Timeout: atomic.LoadUint64(&s.Timeout),
+		Resend:  atomic.LoadUint64(&s.Resend),
+		Failed:  atomic.LoadUint64(&s.Failed),
+		Latency: s.Latency.Summary(),
+	}
+	s.lock.Lock()
+	if len(s.results) > 0 {
+		summary.Results = make(map[string]uint64, len(s.results))
+		for result, n := range s.results {
+			summary.Results[strconv.FormatUint(uint64(result), 10)] = n
+		}
+	}
+	s.lock.Unlock()
+	if summary.Sent > 0 && summary.Success < summary.Sent {
+		summary.ErrorRate = float64(summary.Sent-summary.Success) / float64(summary.Sent)
+	}
+	return summary
+}
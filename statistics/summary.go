@@ -0,0 +1,38 @@
+package statistics
+
+import (
+	"encoding/json"
+	"os"
+)
+
+const clientSummaryFile = "CMPP_Stress_Test_Report.json"
+
+// 客户端压测结果汇总，结束时输出至文件
+type ClientSummary struct {
+	Submit    *SubmitSummary    `json:"submit"`
+	Report    *ReportSummary    `json:"report"`
+	Mo        *MoSummary        `json:"mo"`
+	Heartbeat *HeartbeatSummary `json:"heartbeat"`
+	Workers   *WorkersSummary   `json:"workers"`
+	Capacity  []CapacityResult  `json:"capacity,omitempty"`
+	Adaptive  []AdaptiveResult  `json:"adaptive,omitempty"`
+	Mix       *MixSummary       `json:"mix,omitempty"`
+	Agents    []AgentSummary    `json:"agents,omitempty"` // 分布式压测时各 agent 的汇总
+}
+
+type AgentSummary struct {
+	Addr    string         `json:"addr"`
+	Summary *ClientSummary `json:"summary"`
+}
+
+// 写入文件，name 为空时使用默认文件名
+func (s *ClientSummary) WriteFile(name string) error {
+	if name == "" {
+		name = clientSummaryFile
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0644)
+}
@@ -0,0 +1,64 @@
+package statistics
+
+import (
+	"encoding/json"
+	"mock-cmpp-stress-test/config"
+	"os"
+)
+
+const defaultVerdictFile = "CMPP_Stress_Test_Verdict.json"
+
+// 压测结果校验
+type Verdict struct {
+	Passed bool           `json:"passed"`
+	Checks []VerdictCheck `json:"checks"`
+}
+
+type VerdictCheck struct {
+	Name   string  `json:"name"`
+	Actual float64 `json:"actual"`
+	Limit  float64 `json:"limit"`
+	Passed bool    `json:"passed"`
+}
+
+// 按配置的阈值校验汇总结果
+func Evaluate(cfg *config.AssertionConfig, summary *ClientSummary) *Verdict {
+	v := &Verdict{Passed: true}
+	atLeast := func(name string, actual, limit float64) {
+		if limit > 0 {
+			v.add(VerdictCheck{Name: name, Actual: actual, Limit: limit, Passed: actual >= limit})
+		}
+	}
+	atMost := func(name string, actual, limit float64) {
+		if limit > 0 {
+			v.add(VerdictCheck{Name: name, Actual: actual, Limit: limit, Passed: actual <= limit})
+		}
+	}
+	atLeast("min_tps", summary.Workers.Achieved, float64(cfg.MinTps))
+	atMost("max_submit_error_rate", summary.Submit.ErrorRate, cfg.MaxSubmitErrorRate)
+	atMost("max_missing_report_rate", summary.Report.MissingRate, cfg.MaxMissingReportRate)
+	atMost("max_submit_p99", summary.Submit.Latency.P99Ms, float64(cfg.MaxSubmitP99))
+	atMost("max_report_p99", summary.Report.Latency.P99Ms, float64(cfg.MaxReportP99))
+	if summary.Mix != nil {
+		atMost("max_mix_deviation", summary.Mix.MaxDeviation, cfg.MaxMixDeviation)
+	}
+	return v
+}
+
+func (v *Verdict) add(c VerdictCheck) {
+	v.Checks = append(v.Checks, c)
+	if !c.Passed {
+		v.Passed = false
+	}
+}
+
+func (v *Verdict) WriteFile(name string) error {
+	if name == "" {
+		name = defaultVerdictFile
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0644)
+}
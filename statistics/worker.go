@@ -0,0 +1,67 @@
+package statistics
+
+import (
+	"sync"
+	"time"
+)
+
+// 压测线程结果统计
+type WorkerStatistics struct {
+	lock    sync.Mutex
+	workers []WorkerSummary
+	sent    uint64
+	start   time.Time
+	end     time.Time
+}
+
+type WorkerSummary struct {
+	Name      string  `json:"name"`
+	Target    uint64  `json:"target"`
+	Scheduled uint64  `json:"scheduled"`
+	Sent      uint64  `json:"sent"`
+	ElapsedS  float64 `json:"elapsed_s"`
+	Achieved  float64 `json:"achieved"`
+	MaxLagMs  float64 `json:"max_lag_ms"`
+}
+
+type WorkersSummary struct {
+	Sent     uint64          `json:"sent"`
+	Achieved float64         `json:"achieved"` // 第一个压测线程开始至最后一个结束期间的平均每秒发送量
+	Workers  []WorkerSummary `json:"workers"`
+}
+
+// 登记结束的压测线程
+func (s *WorkerStatistics) Add(w WorkerSummary, start, end time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.workers = append(s.workers, w)
+	s.sent += w.Sent
+	if s.start.IsZero() || start.Before(s.start) {
+		s.start = start
+	}
+	if end.After(s.end) {
+		s.end = end
+	}
+}
+
+func (s *WorkerStatistics) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.workers, s.sent = nil, 0
+	s.start, s.end = time.Time{}, time.Time{}
+}
+
+func (s *WorkerStatistics) Summary() *WorkersSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	summary := &WorkersSummary{
+		Sent:    s.sent,
+		Workers: append([]WorkerSummary{}, s.workers...),
+	}
+	if d := s.end.Sub(s.start).Seconds(); d > 0 {
+		summary.Achieved = float64(s.sent) / d
+	}
+	return summary
+}
@@ -0,0 +1,162 @@
+package stress_test_service
+
+import (
+	"mock-cmpp-stress-test/cmpp/pkg"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAdaptiveDecrease = 0.5
+	defaultAdaptiveInterval = 1 * time.Second
+)
+
+// 按网关反馈调整每秒发送量（AIMD）：出现流量控制、超时或平均响应时间超过上限时乘性降速，否则加性提速
+type rateController struct {
+	name       string
+	rate       uint64
+	min        uint64
+	max        uint64
+	increase   uint64
+	decrease   float64
+	maxLatency time.Duration
+	interval   time.Duration
+
+	generation uint64
+	last       pkg.SubmitFeedback
+	lastUpdate time.Time
+
+	start         time.Time
+	success       uint64 // 成功 SubmitResp 总数
+	backoffs      uint64 // 降速次数
+	peakSustained uint64 // 未触发降速周期内网关实际处理的最高每秒成功数
+}
+
+// 未启用自适应时返回 nil
+func newRateController(worker config.StressTestWorker) *rateController {
+	cfg := worker.Adaptive
+	if cfg == nil || !cfg.Enable {
+		return nil
+	}
+	rc := &rateController{
+		name:       worker.Name,
+		rate:       worker.Concurrency,
+		min:        cfg.MinRate,
+		max:        cfg.MaxRate,
+		increase:   cfg.Increase,
+		decrease:   cfg.Decrease,
+		maxLatency: time.Duration(cfg.MaxLatency) * time.Millisecond,
+		interval:   time.Duration(cfg.Interval) * time.Second,
+	}
+	if rc.min == 0 {
+		rc.min = 1
+	}
+	if rc.max == 0 {
+		rc.max = worker.Concurrency * 10
+	}
+	if rc.increase == 0 {
+		rc.increase = worker.Concurrency / 10
+		if rc.increase == 0 {
+			rc.increase = 1
+		}
+	}
+	if rc.decrease <= 0 || rc.decrease >= 1 {
+		rc.decrease = defaultAdaptiveDecrease
+	}
+	if rc.interval == 0 {
+		rc.interval = defaultAdaptiveInterval
+	}
+	if rc.rate < rc.min {
+		rc.rate = rc.min
+	}
+	if rc.rate > rc.max {
+		rc.rate = rc.max
+	}
+	return rc
+}
+
+func (rc *rateController) Rate() uint64 {
+	return rc.rate
+}
+
+// 每个调整周期根据该周期内的反馈调整速率，返回调整后的速率
+func (rc *rateController) Update(t *workerTargets, now time.Time, logger *zap.Logger) uint64 {
+	// 首次调用或连接变化后重新取基准值
+	if t.generation != rc.generation {
+		rc.generation = t.generation
+		rc.last = t.Feedback()
+		rc.lastUpdate = now
+		if rc.start.IsZero() {
+			rc.start = now
+		}
+		return rc.rate
+	}
+	elapsed := now.Sub(rc.lastUpdate)
+	if elapsed < rc.interval {
+		return rc.rate
+	}
+
+	fb := t.Feedback()
+	success := fb.Success - rc.last.Success
+	flowControl := fb.FlowControl - rc.last.FlowControl
+	timeout := fb.Timeout - rc.last.Timeout
+	var avgLatency time.Duration
+	if success > 0 {
+		avgLatency = time.Duration((fb.LatencySum-rc.last.LatencySum)/success) * time.Microsecond
+	}
+	rc.last = fb
+	rc.lastUpdate = now
+	rc.success += success
+
+	achieved := uint64(float64(success) / elapsed.Seconds())
+	congested := flowControl > 0 || timeout > 0 || (rc.maxLatency > 0 && avgLatency > rc.maxLatency)
+	if congested {
+		rc.backoffs++
+		rc.rate = uint64(float64(rc.rate) * rc.decrease)
+		if rc.rate < rc.min {
+			rc.rate = rc.min
+		}
+	} else {
+		if achieved > rc.peakSustained {
+			rc.peakSustained = achieved
+		}
+		rc.rate += rc.increase
+		if rc.rate > rc.max {
+			rc.rate = rc.max
+		}
+	}
+
+	logger.Info("Stress Test Adaptive Rate",
+		zap.String("Name", rc.name),
+		zap.Uint64("Rate", rc.rate),
+		zap.Uint64("Achieved", achieved),
+		zap.Uint64("FlowControl", flowControl),
+		zap.Uint64("Timeout", timeout),
+		zap.Duration("AvgLatency", avgLatency),
+		zap.Bool("Congested", congested))
+	return rc.rate
+}
+
+// 输出网关实际承受的速率
+func (rc *rateController) Report(logger *zap.Logger) {
+	var avg uint64
+	if d := rc.lastUpdate.Sub(rc.start).Seconds(); d > 0 {
+		avg = uint64(float64(rc.success) / d)
+	}
+	logger.Info("Stress Test Adaptive Result",
+		zap.String("Name", rc.name),
+		zap.Uint64("FinalRate", rc.rate),
+		zap.Uint64("PeakSustained", rc.peakSustained),
+		zap.Uint64("AvgAchieved", avg),
+		zap.Uint64("Backoffs", rc.backoffs))
+	statistics.CollectService.Adaptive.Add(statistics.AdaptiveResult{
+		Name:          rc.name,
+		FinalRate:     rc.rate,
+		PeakSustained: rc.peakSustained,
+		AvgAchieved:   avg,
+		Backoffs:      rc.backoffs,
+	})
+}
@@ -0,0 +1,187 @@
+package stress_test_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAgentListen = "127.0.0.1:9100"
+
+	AgentIdle    = "idle"
+	AgentRunning = "running"
+	AgentDone    = "done"
+)
+
+// coordinator 下发的压测任务
+type AgentRunRequest struct {
+	Workers []config.StressTestWorker `json:"workers"`
+	StartAt int64                     `json:"start_at"` // 开始时间，Unix 毫秒
+}
+
+type AgentStatus struct {
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// 分布式压测 agent：通过 HTTP/JSON 接收 coordinator 下发的压测线程，使用本进程的客户端连接发送
+//
+//	POST /run    下发并在 start_at 启动压测线程
+//	POST /stop   停止当前压测
+//	GET  /status 当前状态
+//	GET  /stats  统计快照（含延迟直方图）
+type agent struct {
+	st     *StressTest
+	server *http.Server
+
+	lock   sync.Mutex
+	status AgentStatus
+	cancel context.CancelFunc
+}
+
+func (st *StressTest) startAgent() error {
+	addr := st.cfg.Distributed.Listen
+	if addr == "" {
+		addr = defaultAgentListen
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	a := &agent{st: st, status: AgentStatus{State: AgentIdle}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", a.handleRun)
+	mux.HandleFunc("/stop", a.handleStop)
+	mux.HandleFunc("/status", a.handleStatus)
+	mux.HandleFunc("/stats", a.handleStats)
+	a.server = &http.Server{Handler: mux}
+	st.agent = a
+
+	go func() {
+		if err := a.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			st.Logger.Error("Stress Test Agent Serve Error", zap.Error(err))
+		}
+	}()
+	st.Logger.Info("Stress Test Agent Start", zap.String("Listen", addr))
+	return nil
+}
+
+func (a *agent) Stop() {
+	a.lock.Lock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_ = a.server.Shutdown(ctx)
+}
+
+func (a *agent) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req AgentRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Workers) == 0 {
+		http.Error(w, "workers can't be empty", http.StatusBadRequest)
+		return
+	}
+	for _, worker := range req.Workers {
+		if _, _, err := a.st.prepareWorker(worker); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	a.lock.Lock()
+	if a.status.State == AgentRunning {
+		a.lock.Unlock()
+		http.Error(w, "agent is running", http.StatusConflict)
+		return
+	}
+	// 开始前清空统计，再次下发时 coordinator 只合并本次的结果
+	statistics.CollectService.Reset()
+	ctx, cancel := context.WithCancel(a.st.ctx)
+	a.cancel = cancel
+	a.status = AgentStatus{State: AgentRunning}
+	status := a.status
+	a.lock.Unlock()
+
+	go a.run(ctx, req)
+	writeJSON(w, status)
+}
+
+// 等待到开始时间后启动压测线程，结束后等待响应及状态报告
+func (a *agent) run(ctx context.Context, req AgentRunRequest) {
+	startAt := time.Unix(0, req.StartAt*int64(time.Millisecond))
+	a.st.Logger.Info("Stress Test Agent Run",
+		zap.Int("Workers", len(req.Workers)),
+		zap.Time("StartAt", startAt))
+
+	var err error
+	t := time.NewTimer(time.Until(startAt))
+	select {
+	case <-t.C:
+		if err = a.st.RunWorkers(ctx, req.Workers); err == nil {
+			a.st.waitReports(a.st.cfg.WaitTimeout)
+		}
+	case <-ctx.Done():
+		t.Stop()
+		err = errors.New("agent stopped before start")
+	}
+
+	a.lock.Lock()
+	a.status = AgentStatus{State: AgentDone}
+	if err != nil {
+		a.status.Error = err.Error()
+	}
+	a.cancel()
+	a.lock.Unlock()
+	a.st.Logger.Info("Stress Test Agent Done", zap.Error(err))
+}
+
+func (a *agent) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.lock.Lock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	status := a.status
+	a.lock.Unlock()
+	writeJSON(w, status)
+}
+
+func (a *agent) handleStatus(w http.ResponseWriter, r *http.Request) {
+	a.lock.Lock()
+	status := a.status
+	a.lock.Unlock()
+	writeJSON(w, status)
+}
+
+func (a *agent) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, statistics.CollectService.Snapshot())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,226 @@
+package stress_test_service
+
+import (
+	"mock-cmpp-stress-test/cmpp/pkg"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCapacityStepDuration = 30 * time.Second
+	defaultCapacityCooldown     = 5 * time.Second
+	defaultCapacityErrorRate    = 0.01
+	defaultCapacityMinAchieved  = 0.9
+	// 客户端提交队列最长 1 秒批量发送一次，每级开始后等待队列稳定再测量
+	capacitySettle = 1 * time.Second
+)
+
+// 容量探测：逐级提高速率直到某一级不达标，再在最后达标与首个不达标速率之间二分查找
+// 每级结束后暂停 cooldown 等待积压的响应返回，避免影响下一级的测量
+type capacitySearch struct {
+	name             string
+	step             uint64
+	max              uint64
+	precision        uint64
+	stepDuration     time.Duration
+	cooldown         time.Duration
+	maxErrorRate     float64
+	maxLatency       time.Duration
+	maxReportLatency time.Duration
+	minAchieved      float64
+
+	rate uint64 // 当前测量的速率
+	good uint64 // 最后达标的速率
+	bad  uint64 // 首个不达标的速率，0 表示尚未出现
+
+	generation  uint64
+	last        pkg.SubmitFeedback
+	settleUntil time.Time // 本级开始测量的时间
+	stepStart   time.Time
+	coolUntil   time.Time
+	steps       []statistics.CapacityStep
+}
+
+// 未启用容量探测时返回 nil
+func newCapacitySearch(worker config.StressTestWorker) *capacitySearch {
+	cfg := worker.Capacity
+	if cfg == nil || !cfg.Enable {
+		return nil
+	}
+	cs := &capacitySearch{
+		name:             worker.Name,
+		rate:             cfg.Start,
+		step:             cfg.Step,
+		max:              cfg.Max,
+		precision:        cfg.Precision,
+		stepDuration:     time.Duration(cfg.StepDuration) * time.Second,
+		cooldown:         time.Duration(cfg.Cooldown) * time.Second,
+		maxErrorRate:     cfg.MaxErrorRate,
+		maxLatency:       time.Duration(cfg.MaxLatency) * time.Millisecond,
+		maxReportLatency: time.Duration(cfg.MaxReportLatency) * time.Millisecond,
+		minAchieved:      cfg.MinAchieved,
+	}
+	if cs.rate == 0 {
+		cs.rate = worker.Concurrency
+	}
+	if cs.rate == 0 {
+		cs.rate = 1
+	}
+	if cs.step == 0 {
+		cs.step = cs.rate
+	}
+	if cs.max == 0 {
+		cs.max = cs.rate * 100
+	}
+	if cs.precision == 0 {
+		cs.precision = cs.step / 10
+		if cs.precision == 0 {
+			cs.precision = 1
+		}
+	}
+	if cs.stepDuration == 0 {
+		cs.stepDuration = defaultCapacityStepDuration
+	}
+	if cfg.Cooldown == 0 {
+		cs.cooldown = defaultCapacityCooldown
+	}
+	if cs.maxErrorRate <= 0 {
+		cs.maxErrorRate = defaultCapacityErrorRate
+	}
+	if cs.minAchieved <= 0 || cs.minAchieved > 1 {
+		cs.minAchieved = defaultCapacityMinAchieved
+	}
+	return cs
+}
+
+func (cs *capacitySearch) Rate() uint64 {
+	return cs.rate
+}
+
+// 开始发送当前速率，等待 capacitySettle 后开始测量
+func (cs *capacitySearch) begin(t *workerTargets, now time.Time) {
+	cs.generation = t.generation
+	cs.settleUntil = now.Add(capacitySettle)
+}
+
+// 每级结束时测量并决定下一级速率，返回当前应发送的速率（暂停时为 0）及探测是否结束
+func (cs *capacitySearch) Update(t *workerTargets, now time.Time, logger *zap.Logger) (uint64, bool) {
+	if !cs.coolUntil.IsZero() {
+		if now.Before(cs.coolUntil) {
+			return 0, false
+		}
+		cs.coolUntil = time.Time{}
+		cs.begin(t, now)
+		return cs.rate, false
+	}
+	// 首次调用或连接变化后重新测量本级
+	if t.generation != cs.generation {
+		cs.begin(t, now)
+		return cs.rate, false
+	}
+	if !cs.settleUntil.IsZero() {
+		if now.Before(cs.settleUntil) {
+			return cs.rate, false
+		}
+		cs.settleUntil = time.Time{}
+		cs.last = t.Feedback()
+		cs.stepStart = now
+		return cs.rate, false
+	}
+	elapsed := now.Sub(cs.stepStart)
+	if elapsed < cs.stepDuration {
+		return cs.rate, false
+	}
+
+	step := cs.measure(t.Feedback(), elapsed)
+	cs.steps = append(cs.steps, step)
+	logger.Info("Stress Test Capacity Step",
+		zap.String("Name", cs.name),
+		zap.Uint64("Rate", step.Rate),
+		zap.Float64("Achieved", step.Achieved),
+		zap.Float64("ErrorRate", step.ErrorRate),
+		zap.Float64("LatencyMs", step.LatencyMs),
+		zap.Float64("ReportLatencyMs", step.ReportLatencyMs),
+		zap.Bool("Passed", step.Passed))
+
+	next, done := cs.next(step.Passed)
+	if done {
+		return cs.rate, true
+	}
+	cs.rate = next
+	if cs.cooldown > 0 {
+		cs.coolUntil = now.Add(cs.cooldown)
+		return 0, false
+	}
+	cs.begin(t, now)
+	return cs.rate, false
+}
+
+func (cs *capacitySearch) measure(fb pkg.SubmitFeedback, elapsed time.Duration) statistics.CapacityStep {
+	success := fb.Success - cs.last.Success
+	failed := fb.Failed - cs.last.Failed + fb.Timeout - cs.last.Timeout
+	reports := fb.Reports - cs.last.Reports
+
+	step := statistics.CapacityStep{
+		Rate:     cs.rate,
+		Achieved: float64(success) / elapsed.Seconds(),
+	}
+	if success+failed > 0 {
+		step.ErrorRate = float64(failed) / float64(success+failed)
+	}
+	var latency, reportLatency time.Duration
+	if success > 0 {
+		latency = time.Duration((fb.LatencySum-cs.last.LatencySum)/success) * time.Microsecond
+	}
+	if reports > 0 {
+		reportLatency = time.Duration((fb.ReportLatencySum-cs.last.ReportLatencySum)/reports) * time.Microsecond
+	}
+	step.LatencyMs = float64(latency) / float64(time.Millisecond)
+	step.ReportLatencyMs = float64(reportLatency) / float64(time.Millisecond)
+
+	step.Passed = step.Achieved >= cs.minAchieved*float64(cs.rate) &&
+		step.ErrorRate <= cs.maxErrorRate &&
+		(cs.maxLatency == 0 || latency <= cs.maxLatency) &&
+		(cs.maxReportLatency == 0 || reportLatency <= cs.maxReportLatency)
+	return step
+}
+
+// 尚未出现不达标时逐级提高，否则二分查找，区间小于精度时结束
+func (cs *capacitySearch) next(passed bool) (uint64, bool) {
+	if passed {
+		cs.good = cs.rate
+	} else {
+		cs.bad = cs.rate
+	}
+	if cs.bad == 0 {
+		if cs.rate >= cs.max {
+			return 0, true
+		}
+		next := cs.rate + cs.step
+		if next > cs.max {
+			next = cs.max
+		}
+		return next, false
+	}
+	if cs.bad <= cs.good+cs.precision {
+		return 0, true
+	}
+	return cs.good + (cs.bad-cs.good)/2, false
+}
+
+// 输出探测到的容量及测量曲线
+func (cs *capacitySearch) Report(logger *zap.Logger) {
+	logger.Info("Stress Test Capacity Result",
+		zap.String("Name", cs.name),
+		zap.Uint64("Capacity", cs.good),
+		zap.Uint64("FirstFailed", cs.bad),
+		zap.Int("Steps", len(cs.steps)))
+	statistics.CollectService.Capacity.Add(statistics.CapacityResult{
+		Name:     cs.name,
+		Capacity: cs.good,
+		Steps:    cs.steps,
+	})
+}
@@ -0,0 +1,227 @@
+package stress_test_service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCoordinatorStartDelay = 2000
+	coordinatorRequestTimeout    = 10 * time.Second
+	// 连续查询状态失败的次数上限，超过后认为 agent 已失败
+	coordinatorMaxStatusErrors = 5
+)
+
+// 分布式压测 coordinator：检查各 agent 空闲后下发压测线程并约定同一开始时间，
+// 等待全部结束后拉取各 agent 的统计快照，合并后输出报告并校验结果
+func (st *StressTest) RunCoordinator() error {
+	cfg := st.cfg.Distributed
+	client := &http.Client{Timeout: coordinatorRequestTimeout}
+	agents := make([]string, 0, len(cfg.Agents))
+	for _, addr := range cfg.Agents {
+		agents = append(agents, strings.TrimRight(addr, "/"))
+	}
+
+	for _, addr := range agents {
+		var status AgentStatus
+		if err := agentCall(client, http.MethodGet, addr+"/status", nil, &status); err != nil {
+			return err
+		}
+		if status.State == AgentRunning {
+			return fmt.Errorf("agent %s is running", addr)
+		}
+	}
+
+	delay := cfg.StartDelay
+	if delay == 0 {
+		delay = defaultCoordinatorStartDelay
+	}
+	startAt := time.Now().Add(time.Duration(delay) * time.Millisecond)
+	// 总数或速率少于 agent 数时靠后的 agent 可能分不到压测线程，不下发也不合并其统计
+	dispatched := make([]string, 0, len(agents))
+	for i, addr := range agents {
+		req := AgentRunRequest{
+			Workers: splitWorkers(*st.cfg.Workers, i, len(agents)),
+			StartAt: startAt.UnixNano() / int64(time.Millisecond),
+		}
+		if len(req.Workers) == 0 {
+			st.Logger.Warn("Stress Test Coordinator Skip Agent", zap.String("Agent", addr))
+			continue
+		}
+		if err := agentCall(client, http.MethodPost, addr+"/run", req, nil); err != nil {
+			st.stopAgents(client, dispatched)
+			return err
+		}
+		dispatched = append(dispatched, addr)
+		st.Logger.Info("Stress Test Coordinator Dispatch",
+			zap.String("Agent", addr),
+			zap.Int("Workers", len(req.Workers)),
+			zap.Time("StartAt", startAt))
+	}
+
+	if err := st.waitAgents(client, dispatched); err != nil {
+		st.stopAgents(client, dispatched)
+		return err
+	}
+
+	snapshots := make([]*statistics.Snapshot, 0, len(dispatched))
+	summaries := make([]statistics.AgentSummary, 0, len(dispatched))
+	for _, addr := range dispatched {
+		var snap statistics.Snapshot
+		if err := agentCall(client, http.MethodGet, addr+"/stats", nil, &snap); err != nil {
+			return err
+		}
+		snapshots = append(snapshots, &snap)
+		summaries = append(summaries, statistics.AgentSummary{Addr: addr, Summary: snap.Summary})
+	}
+	merged := statistics.MergeSnapshots(snapshots)
+	merged.Agents = summaries
+
+	collect := statistics.CollectService
+	collect.LogSummary(merged)
+	if err := merged.WriteFile(""); err != nil {
+		st.Logger.Error("Stress Test Coordinator Write Error", zap.Error(err))
+	}
+	collect.Assert(merged)
+	return nil
+}
+
+// 等待所有 agent 结束，超过 timeout 或 agent 连续 coordinatorMaxStatusErrors 次无法访问时停止
+func (st *StressTest) waitAgents(client *http.Client, agents []string) error {
+	statusErrors := make(map[string]int, len(agents))
+	var deadline time.Time
+	if timeout := st.cfg.Distributed.Timeout; timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout) * time.Second)
+	}
+	tk := time.NewTicker(reportInterval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-tk.C:
+		case <-st.ctx.Done():
+			return errors.New("coordinator stopped")
+		}
+
+		running := 0
+		for _, addr := range agents {
+			var status AgentStatus
+			if err := agentCall(client, http.MethodGet, addr+"/status", nil, &status); err != nil {
+				statusErrors[addr]++
+				st.Logger.Warn("Stress Test Coordinator Status Error",
+					zap.String("Agent", addr),
+					zap.Int("Errors", statusErrors[addr]),
+					zap.Error(err))
+				if statusErrors[addr] >= coordinatorMaxStatusErrors {
+					return fmt.Errorf("agent %s unreachable: %s", addr, err.Error())
+				}
+				running++
+				continue
+			}
+			statusErrors[addr] = 0
+			if status.State == AgentRunning {
+				running++
+			} else if status.Error != "" {
+				st.Logger.Error("Stress Test Coordinator Agent Error", zap.String("Agent", addr), zap.String("Error", status.Error))
+			}
+		}
+		if running == 0 {
+			return nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("%d agents still running after timeout", running)
+		}
+	}
+}
+
+func (st *StressTest) stopAgents(client *http.Client, agents []string) {
+	for _, addr := range agents {
+		if err := agentCall(client, http.MethodPost, addr+"/stop", nil, nil); err != nil {
+			st.Logger.Error("Stress Test Coordinator Stop Agent Error", zap.String("Agent", addr), zap.Error(err))
+		}
+	}
+}
+
+func agentCall(client *http.Client, method, url string, req, resp interface{}) error {
+	var body []byte
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	r, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s %s: %s %s", method, url, res.Status, strings.TrimSpace(string(msg)))
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+// 第 i 个 agent 的压测线程：速率、总数按 agent 数均分，余数分给靠前的 agent
+// 分到的总数或速率为 0 的压测线程不下发给该 agent
+func splitWorkers(workers []config.StressTestWorker, i, n int) []config.StressTestWorker {
+	result := make([]config.StressTestWorker, 0, len(workers))
+	for _, w := range workers {
+		if w.TotalNum > 0 && share(w.TotalNum, i, n) == 0 {
+			continue
+		}
+		if w.Concurrency > 0 && w.Profile == nil && share(w.Concurrency, i, n) == 0 {
+			continue
+		}
+		w.Concurrency = share(w.Concurrency, i, n)
+		w.TotalNum = share(w.TotalNum, i, n)
+		if w.Adaptive != nil {
+			adaptive := *w.Adaptive
+			adaptive.MinRate = share(adaptive.MinRate, i, n)
+			adaptive.MaxRate = share(adaptive.MaxRate, i, n)
+			adaptive.Increase = share(adaptive.Increase, i, n)
+			w.Adaptive = &adaptive
+		}
+		if w.Profile != nil {
+			profile := *w.Profile
+			profile.From = share(profile.From, i, n)
+			profile.To = share(profile.To, i, n)
+			profile.SpikeRate = share(profile.SpikeRate, i, n)
+			profile.Amplitude = share(profile.Amplitude, i, n)
+			profile.Steps = make([]config.LoadStep, len(w.Profile.Steps))
+			for j, step := range w.Profile.Steps {
+				profile.Steps[j] = config.LoadStep{Rate: share(step.Rate, i, n), Hold: step.Hold}
+			}
+			w.Profile = &profile
+		}
+		result = append(result, w)
+	}
+	return result
+}
+
+func share(v uint64, i, n int) uint64 {
+	s := v / uint64(n)
+	if uint64(i) < v%uint64(n) {
+		s++
+	}
+	return s
+}
@@ -0,0 +1,174 @@
+package stress_test_service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mock-cmpp-stress-test/config"
+	"time"
+)
+
+// 负载曲线：按开始后的时间计算每秒发送量
+type LoadProfile interface {
+	Rate(elapsed time.Duration) uint64
+	// 负载曲线的自然持续时间，0 表示不限
+	Duration() time.Duration
+}
+
+// 未配置负载曲线时返回 nil，按 concurrency 匀速发送
+func NewLoadProfile(worker config.StressTestWorker) (LoadProfile, error) {
+	cfg := worker.Profile
+	if cfg == nil || cfg.Type == "" || cfg.Type == "constant" {
+		return nil, nil
+	}
+	switch cfg.Type {
+	case "ramp":
+		if cfg.Duration == 0 {
+			return nil, errors.New("ramp profile duration can't be 0")
+		}
+		return &rampProfile{
+			from:     float64(cfg.From),
+			to:       float64(cfg.To),
+			duration: seconds(cfg.Duration),
+			hold:     seconds(cfg.Hold),
+			down:     seconds(cfg.Down),
+		}, nil
+	case "step":
+		if len(cfg.Steps) == 0 {
+			return nil, errors.New("step profile steps can't be empty")
+		}
+		return &stepProfile{steps: cfg.Steps}, nil
+	case "spike":
+		if cfg.SpikeDuration == 0 {
+			return nil, errors.New("spike profile spike_duration can't be 0")
+		}
+		// 间隔不大于持续时间时突发不会结束，不回落到基准速率
+		if cfg.SpikeInterval > 0 && cfg.SpikeInterval <= cfg.SpikeDuration {
+			return nil, errors.New("spike profile spike_interval must be greater than spike_duration")
+		}
+		return &spikeProfile{
+			base:     worker.Concurrency,
+			rate:     cfg.SpikeRate,
+			at:       seconds(cfg.SpikeAt),
+			duration: seconds(cfg.SpikeDuration),
+			interval: seconds(cfg.SpikeInterval),
+		}, nil
+	case "wave":
+		if cfg.Period == 0 {
+			return nil, errors.New("wave profile period can't be 0")
+		}
+		return &waveProfile{
+			base:      float64(worker.Concurrency),
+			amplitude: float64(cfg.Amplitude),
+			period:    seconds(cfg.Period),
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid load profile type: %s", cfg.Type)
+}
+
+func seconds(s uint) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+// =====================Ramp=====================
+type rampProfile struct {
+	from, to             float64
+	duration, hold, down time.Duration
+}
+
+func (p *rampProfile) Rate(elapsed time.Duration) uint64 {
+	if elapsed < p.duration {
+		return uint64(p.from + (p.to-p.from)*elapsed.Seconds()/p.duration.Seconds())
+	}
+	elapsed -= p.duration
+	if p.down == 0 || elapsed < p.hold {
+		return uint64(p.to)
+	}
+	elapsed -= p.hold
+	if elapsed < p.down {
+		return uint64(p.to + (p.from-p.to)*elapsed.Seconds()/p.down.Seconds())
+	}
+	return uint64(p.from)
+}
+
+func (p *rampProfile) Duration() time.Duration {
+	if p.down == 0 {
+		return 0
+	}
+	return p.duration + p.hold + p.down
+}
+
+// =====================Ramp=====================
+
+// =====================Step=====================
+type stepProfile struct {
+	steps []config.LoadStep
+}
+
+func (p *stepProfile) Rate(elapsed time.Duration) uint64 {
+	for _, step := range p.steps {
+		hold := seconds(step.Hold)
+		if elapsed < hold {
+			return step.Rate
+		}
+		elapsed -= hold
+	}
+	return p.steps[len(p.steps)-1].Rate
+}
+
+func (p *stepProfile) Duration() time.Duration {
+	var d time.Duration
+	for _, step := range p.steps {
+		d += seconds(step.Hold)
+	}
+	return d
+}
+
+// =====================Step=====================
+
+// =====================Spike=====================
+type spikeProfile struct {
+	base, rate             uint64
+	at, duration, interval time.Duration
+}
+
+func (p *spikeProfile) Rate(elapsed time.Duration) uint64 {
+	if elapsed < p.at {
+		return p.base
+	}
+	elapsed -= p.at
+	if p.interval > 0 {
+		elapsed %= p.interval
+	}
+	if elapsed < p.duration {
+		return p.rate
+	}
+	return p.base
+}
+
+func (p *spikeProfile) Duration() time.Duration {
+	return 0
+}
+
+// =====================Spike=====================
+
+// =====================Wave=====================
+type waveProfile struct {
+	base, amplitude float64
+	period          time.Duration
+}
+
+func (p *waveProfile) Rate(elapsed time.Duration) uint64 {
+	phase := 2 * math.Pi * elapsed.Seconds() / p.period.Seconds()
+	rate := p.base - p.amplitude*math.Cos(phase)
+	if rate < 0 {
+		return 0
+	}
+	return uint64(rate)
+}
+
+func (p *waveProfile) Duration() time.Duration {
+	return 0
+}
+
+// =====================Wave=====================
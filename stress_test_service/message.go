@@ -0,0 +1,106 @@
+package stress_test_service
+
+import (
+	"mock-cmpp-stress-test/cmpp/pkg"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/utils/msg_template"
+	"sync/atomic"
+)
+
+// 压测短信，内容及手机号支持模板变量，每次发送时渲染
+type messageTemplate struct {
+	msg     config.TextMessages
+	content *msg_template.Template
+	phone   *msg_template.Template
+	phones  []*msg_template.Template
+	kind    string // 混合负载类型，未启用时为空
+}
+
+func compileMessages(messages []config.TextMessages) ([]*messageTemplate, error) {
+	result := make([]*messageTemplate, 0, len(messages))
+	for _, msg := range messages {
+		content, err := msg_template.Compile(msg.Content)
+		if err != nil {
+			return nil, err
+		}
+		phone, err := msg_template.Compile(msg.Phone)
+		if err != nil {
+			return nil, err
+		}
+		phones := make([]*msg_template.Template, 0, len(msg.Phones))
+		for _, p := range msg.Phones {
+			t, err := msg_template.Compile(p)
+			if err != nil {
+				return nil, err
+			}
+			phones = append(phones, t)
+		}
+		result = append(result, &messageTemplate{
+			msg:     msg,
+			content: content,
+			phone:   phone,
+			phones:  phones,
+		})
+	}
+	return result, nil
+}
+
+// 不含模板变量的短信，内容及手机号原样发送
+func literalMessage(msg config.TextMessages) *messageTemplate {
+	phones := make([]*msg_template.Template, 0, len(msg.Phones))
+	for _, p := range msg.Phones {
+		phones = append(phones, msg_template.Literal(p))
+	}
+	return &messageTemplate{
+		msg:     msg,
+		content: msg_template.Literal(msg.Content),
+		phone:   msg_template.Literal(msg.Phone),
+		phones:  phones,
+	}
+}
+
+func (m *messageTemplate) Render(ctx *msg_template.Context) *config.TextMessages {
+	msg := m.msg
+	msg.Content = m.content.Render(ctx)
+	msg.Phone = m.phone.Render(ctx)
+	if len(m.phones) > 0 {
+		msg.Phones = make([]string, len(m.phones))
+		for i, p := range m.phones {
+			msg.Phones[i] = p.Render(ctx)
+		}
+	}
+	return &msg
+}
+
+// 从短信来源取出并渲染下一条短信及其混合负载类型，序号在本次压测内全局递增；启用手机号生成器时使用生成的号码
+func (st *StressTest) nextMessage(c *pkg.CmppClientManager, worker string) (*config.TextMessages, string, error) {
+	m, err := st.source.Next()
+	if err != nil {
+		return nil, "", err
+	}
+	msg := m.Render(&msg_template.Context{
+		Seq:     atomic.AddUint64(&st.seq, 1),
+		Account: c.UserName,
+		Worker:  worker,
+	})
+	if st.phones != nil {
+		phone, err := st.phones.Next()
+		if err != nil {
+			return nil, "", err
+		}
+		msg.Phone = phone
+		msg.Phones = nil
+		// 群发：生成 dest_num 个号码
+		if msg.DestNum > 1 {
+			msg.Phones = append(make([]string, 0, msg.DestNum), phone)
+			for len(msg.Phones) < msg.DestNum {
+				phone, err := st.phones.Next()
+				if err != nil {
+					return nil, "", err
+				}
+				msg.Phones = append(msg.Phones, phone)
+			}
+		}
+	}
+	return msg, m.kind, nil
+}
@@ -0,0 +1,413 @@
+package stress_test_service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mock-cmpp-stress-test/config"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultMessageWindow = 10000
+
+var ErrMessagesExhausted = errors.New("message source exhausted")
+
+// 压测短信来源，并发安全
+type MessageSource interface {
+	Next() (*messageTemplate, error)
+	Close() error
+}
+
+func NewMessageSource(cfg *config.StressTestConfig) (MessageSource, error) {
+	if cfg.Mix != nil && cfg.Mix.Enable {
+		return newMixMessageSource(cfg.Mix)
+	}
+	if cfg.MessageFile != nil && cfg.MessageFile.Enable {
+		return newFileMessageSource(cfg.MessageFile)
+	}
+	if cfg.Messages == nil || len(*cfg.Messages) == 0 {
+		return nil, errors.New("stress test messages can't be empty")
+	}
+	messages, err := compileMessages(*cfg.Messages)
+	if err != nil {
+		return nil, err
+	}
+	return &staticMessageSource{messages: messages}, nil
+}
+
+// =====================Static=====================
+// 配置文件中 [[stress_test.messages]] 的短信，依次循环发送
+type staticMessageSource struct {
+	messages []*messageTemplate
+	index    uint64
+}
+
+func (s *staticMessageSource) Next() (*messageTemplate, error) {
+	i := (atomic.AddUint64(&s.index, 1) - 1) % uint64(len(s.messages))
+	return s.messages[i], nil
+}
+
+func (s *staticMessageSource) Close() error {
+	return nil
+}
+
+// =====================Static=====================
+
+// =====================File=====================
+// 文件中的一条短信，weight 用于 weighted 模式，offset、account 用于流量回放
+type fileMessage struct {
+	config.TextMessages
+	Weight  uint    `json:"weight"`
+	Offset  float64 `json:"offset"`  // 相对时间偏移，单位毫秒
+	Account string  `json:"account"` // {ip}:{port}_{username}（支持通配符）或用户名
+}
+
+// 从 CSV（首行为表头）或 JSON Lines 文件流式读取短信
+// sequential 按顺序读取；random、weighted 在窗口内随机（按权重）选取，选中后用文件中的下一条补充窗口
+type fileMessageSource struct {
+	lock   sync.Mutex
+	cfg    *config.MessageFileConfig
+	format string
+	window []*fileMessage
+	total  uint64 // 窗口内权重之和
+
+	file    *os.File
+	lines   *bufio.Scanner
+	csv     *csv.Reader
+	header  []string
+	eof     bool
+	records uint64 // 本轮已读取记录数，用于判断空文件
+}
+
+func newFileMessageSource(cfg *config.MessageFileConfig) (*fileMessageSource, error) {
+	s := &fileMessageSource{cfg: cfg, format: strings.ToLower(cfg.Format)}
+	if s.format == "" {
+		s.format = strings.TrimPrefix(strings.ToLower(filepath.Ext(cfg.File)), ".")
+	}
+	if s.format != "csv" && s.format != "jsonl" {
+		return nil, fmt.Errorf("invalid message file format: %s", s.format)
+	}
+	switch cfg.Mode {
+	case "", "sequential", "random", "weighted":
+	default:
+		return nil, fmt.Errorf("invalid message file mode: %s", cfg.Mode)
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	if s.randomMode() {
+		if err := s.fillWindow(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *fileMessageSource) randomMode() bool {
+	return s.cfg.Mode == "random" || s.cfg.Mode == "weighted"
+}
+
+func (s *fileMessageSource) windowSize() int {
+	if s.cfg.Window > 0 {
+		return s.cfg.Window
+	}
+	return defaultMessageWindow
+}
+
+func (s *fileMessageSource) open() error {
+	f, err := os.Open(s.cfg.File)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.eof = false
+	s.records = 0
+	if s.format == "csv" {
+		r := csv.NewReader(bufio.NewReaderSize(f, 64*1024))
+		r.FieldsPerRecord = -1
+		header, err := r.Read()
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("read message file header: %s", err.Error())
+		}
+		s.header = make([]string, len(header))
+		for i, h := range header {
+			s.header[i] = strings.ToLower(strings.TrimSpace(h))
+		}
+		s.csv = r
+	} else {
+		s.lines = bufio.NewScanner(f)
+		s.lines.Buffer(make([]byte, 64*1024), 1024*1024)
+	}
+	return nil
+}
+
+// 读取下一条记录，到达文件末尾且需要循环时重新打开文件
+func (s *fileMessageSource) read() (*fileMessage, error) {
+	for {
+		if s.eof {
+			return nil, io.EOF
+		}
+		msg, err := s.readRecord()
+		if err == io.EOF {
+			s.file.Close()
+			s.eof = true
+			if !s.cfg.Loop || s.records == 0 {
+				return nil, io.EOF
+			}
+			if err := s.open(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.records++
+		return msg, nil
+	}
+}
+
+func (s *fileMessageSource) readRecord() (*fileMessage, error) {
+	if s.format == "csv" {
+		record, err := s.csv.Read()
+		if err != nil {
+			return nil, err
+		}
+		return s.parseCsvRecord(record)
+	}
+
+	for s.lines.Scan() {
+		line := strings.TrimSpace(s.lines.Text())
+		if line == "" {
+			continue
+		}
+		msg := &fileMessage{}
+		if err := json.Unmarshal([]byte(line), msg); err != nil {
+			return nil, fmt.Errorf("parse message file line: %s", err.Error())
+		}
+		return msg, nil
+	}
+	if err := s.lines.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (s *fileMessageSource) parseCsvRecord(record []string) (*fileMessage, error) {
+	msg := &fileMessage{}
+	for i, v := range record {
+		if i >= len(s.header) {
+			break
+		}
+		if err := setMessageField(msg, s.header[i], v); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// CSV 列名与短信字段的对应关系
+func setMessageField(msg *fileMessage, name, value string) error {
+	switch name {
+	case "phone":
+		msg.Phone = strings.TrimSpace(value)
+	case "phones":
+		// 群发号码以 ; 或 | 分隔
+		for _, phone := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '|' }) {
+			if phone = strings.TrimSpace(phone); phone != "" {
+				msg.Phones = append(msg.Phones, phone)
+			}
+		}
+	case "content":
+		msg.Content = value
+	case "extend":
+		msg.Extend = strings.TrimSpace(value)
+	case "encoding":
+		msg.Encoding = strings.TrimSpace(value)
+	case "weight":
+		if value == "" {
+			return nil
+		}
+		w, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid weight: %s", value)
+		}
+		msg.Weight = uint(w)
+	case "offset":
+		offset, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("invalid offset: %s", value)
+		}
+		msg.Offset = offset
+	case "account":
+		msg.Account = strings.TrimSpace(value)
+	default:
+		return setSubmitField(msg, name, strings.TrimSpace(value))
+	}
+	return nil
+}
+
+// CSV 中的提交包字段列，空值表示不配置
+func setSubmitField(msg *fileMessage, name, value string) error {
+	if value == "" {
+		return nil
+	}
+	if msg.Submit == nil {
+		msg.Submit = &config.SubmitFields{}
+	}
+	f := msg.Submit
+
+	var u8 **uint8
+	var str **string
+	switch name {
+	case "registered_delivery":
+		u8 = &f.RegisteredDelivery
+	case "msg_level":
+		u8 = &f.MsgLevel
+	case "fee_user_type":
+		u8 = &f.FeeUserType
+	case "fee_terminal_type":
+		u8 = &f.FeeTerminalType
+	case "tp_pid":
+		u8 = &f.TpPid
+	case "dest_terminal_type":
+		u8 = &f.DestTerminalType
+	case "service_id":
+		str = &f.ServiceId
+	case "fee_terminal_id":
+		str = &f.FeeTerminalId
+	case "msg_src":
+		str = &f.MsgSrc
+	case "fee_type":
+		str = &f.FeeType
+	case "fee_code":
+		str = &f.FeeCode
+	case "valid_time":
+		str = &f.ValidTime
+	case "at_time":
+		str = &f.AtTime
+	case "link_id":
+		str = &f.LinkId
+	default:
+		// 未知列忽略
+		return nil
+	}
+
+	if str != nil {
+		*str = &value
+		return nil
+	}
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", name, value)
+	}
+	v := uint8(n)
+	*u8 = &v
+	return nil
+}
+
+func weightOf(msg *fileMessage) uint64 {
+	if msg.Weight == 0 {
+		return 1
+	}
+	return uint64(msg.Weight)
+}
+
+func (s *fileMessageSource) fillWindow() error {
+	for len(s.window) < s.windowSize() {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.window = append(s.window, msg)
+		s.total += weightOf(msg)
+	}
+	return nil
+}
+
+// 在窗口内选取一条短信
+func (s *fileMessageSource) pick() int {
+	if s.cfg.Mode != "weighted" {
+		return rand.Intn(len(s.window))
+	}
+	w := uint64(rand.Int63n(int64(s.total)))
+	for i, msg := range s.window {
+		weight := weightOf(msg)
+		if w < weight {
+			return i
+		}
+		w -= weight
+	}
+	return len(s.window) - 1
+}
+
+func (s *fileMessageSource) Next() (*messageTemplate, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var msg *fileMessage
+	if !s.randomMode() {
+		m, err := s.read()
+		if err == io.EOF {
+			return nil, ErrMessagesExhausted
+		}
+		if err != nil {
+			return nil, err
+		}
+		msg = m
+	} else {
+		if len(s.window) == 0 {
+			return nil, ErrMessagesExhausted
+		}
+		i := s.pick()
+		msg = s.window[i]
+		s.total -= weightOf(msg)
+
+		next, err := s.read()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if next != nil {
+			s.window[i] = next
+			s.total += weightOf(next)
+		} else {
+			last := len(s.window) - 1
+			s.window[i] = s.window[last]
+			s.window = s.window[:last]
+		}
+	}
+
+	if !s.cfg.Template {
+		return literalMessage(msg.TextMessages), nil
+	}
+	messages, err := compileMessages([]config.TextMessages{msg.TextMessages})
+	if err != nil {
+		return nil, err
+	}
+	return messages[0], nil
+}
+
+func (s *fileMessageSource) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.eof {
+		return nil
+	}
+	s.eof = true
+	return s.file.Close()
+}
+
+// =====================File=====================
@@ -0,0 +1,181 @@
+package stress_test_service
+
+import (
+	"errors"
+	"fmt"
+	"mock-cmpp-stress-test/cmpp/pkg"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"mock-cmpp-stress-test/utils/msg_template"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	mixShort = "short"
+	mixLong  = "long"
+	mixGroup = "group"
+	mixMo    = "mo"
+	mixQuery = "query"
+
+	defaultMixPhone   = "139{{rand_digits:8}}"
+	defaultMixDestNum = 10
+)
+
+var defaultMixContents = map[string]string{
+	mixShort: "验证码 {{rand_digits:6}}，5 分钟内有效。",
+	mixLong:  strings.Repeat("尊敬的客户，您本月的账单已出，请及时查看并按时缴费，感谢您的支持。", 3) + "{{seq}}",
+	mixGroup: "活动通知 {{seq}}：会员日全场八折。",
+	mixMo:    "TD",
+}
+
+// =====================Mix=====================
+// 混合负载：按占比依次发送各类型短信，占比按平滑加权轮询展开为固定的发送序列，实际占比与目标一致
+type mixMessageSource struct {
+	messages []*messageTemplate
+	sequence []int
+	index    uint64
+}
+
+func newMixMessageSource(cfg *config.WorkloadMixConfig) (MessageSource, error) {
+	if len(cfg.Items) == 0 {
+		return nil, errors.New("workload mix items can't be empty")
+	}
+	var total uint
+	messages := make([]*messageTemplate, 0, len(cfg.Items))
+	weights := make([]uint, 0, len(cfg.Items))
+	for _, item := range cfg.Items {
+		m, err := compileMixItem(item)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+		weights = append(weights, item.Ratio)
+		total += item.Ratio
+	}
+	for i, item := range cfg.Items {
+		statistics.CollectService.Mix.SetTarget(item.Type, float64(weights[i])/float64(total))
+	}
+	return &mixMessageSource{messages: messages, sequence: mixSequence(weights)}, nil
+}
+
+func compileMixItem(item config.WorkloadMix) (*messageTemplate, error) {
+	switch item.Type {
+	case mixShort, mixLong, mixGroup:
+	case mixMo:
+		if cfg := config.ConfigObj.ServerConfig; cfg == nil || !cfg.Enable {
+			return nil, errors.New("workload mix mo requires the cmpp server enabled in this process")
+		}
+	case mixQuery:
+	default:
+		return nil, fmt.Errorf("unknown workload mix type %q", item.Type)
+	}
+	if item.Ratio == 0 {
+		return nil, fmt.Errorf("workload mix %s ratio can't be 0", item.Type)
+	}
+
+	// query：content 为业务代码，为空时查询总数
+	if item.Type == mixQuery {
+		if len(item.Content) > pkg.MaxQueryCodeLen {
+			return nil, fmt.Errorf("workload mix query content can't exceed %d bytes", pkg.MaxQueryCodeLen)
+		}
+		m := literalMessage(config.TextMessages{Content: item.Content})
+		m.kind = item.Type
+		return m, nil
+	}
+
+	msg := config.TextMessages{
+		Extend:   item.Extend,
+		Content:  item.Content,
+		Phone:    item.Phone,
+		Encoding: item.Encoding,
+	}
+	if msg.Content == "" {
+		msg.Content = defaultMixContents[item.Type]
+	}
+	if msg.Phone == "" {
+		msg.Phone = defaultMixPhone
+	}
+	if item.Type == mixGroup {
+		msg.DestNum = item.DestNum
+		if msg.DestNum == 0 {
+			msg.DestNum = defaultMixDestNum
+		}
+		if msg.DestNum < 2 || msg.DestNum > pkg.MaxDestUsrTl {
+			return nil, fmt.Errorf("workload mix group dest_num must be between 2 and %d", pkg.MaxDestUsrTl)
+		}
+		msg.Phones = make([]string, msg.DestNum)
+		for i := range msg.Phones {
+			msg.Phones[i] = msg.Phone
+		}
+	}
+
+	compiled, err := compileMessages([]config.TextMessages{msg})
+	if err != nil {
+		return nil, err
+	}
+	m := compiled[0]
+	m.kind = item.Type
+
+	// 按渲染后的内容校验分段数：short、group 为单条，long 为多条
+	// 是否超过单条与 UDH 参考号长度无关，实际分段数按发送连接的 UDH 模式统计
+	sample := m.Render(&msg_template.Context{})
+	enc, units, err := pkg.EncodeContent(sample.Content, sample.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	segments := pkg.SegmentCount(units, enc, false)
+	if item.Type == mixLong && segments < 2 {
+		return nil, errors.New("workload mix long content must exceed a single message")
+	}
+	if (item.Type == mixShort || item.Type == mixGroup || item.Type == mixMo) && segments > 1 {
+		return nil, fmt.Errorf("workload mix %s content must fit in a single message", item.Type)
+	}
+	return m, nil
+}
+
+// 按权重（约去最大公约数后）展开平滑加权轮询序列
+func mixSequence(weights []uint) []int {
+	g := uint(0)
+	for _, w := range weights {
+		g = gcd(g, w)
+	}
+	var total int
+	scaled := make([]int, len(weights))
+	for i, w := range weights {
+		scaled[i] = int(w / g)
+		total += scaled[i]
+	}
+	current := make([]int, len(weights))
+	sequence := make([]int, 0, total)
+	for len(sequence) < total {
+		best := 0
+		for i, w := range scaled {
+			current[i] += w
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		sequence = append(sequence, best)
+	}
+	return sequence
+}
+
+func gcd(a, b uint) uint {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func (s *mixMessageSource) Next() (*messageTemplate, error) {
+	i := (atomic.AddUint64(&s.index, 1) - 1) % uint64(len(s.sequence))
+	return s.messages[s.sequence[i]], nil
+}
+
+func (s *mixMessageSource) Close() error {
+	return nil
+}
+
+// =====================Mix=====================
@@ -0,0 +1,232 @@
+package stress_test_service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mock-cmpp-stress-test/config"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultPhoneLength = 11
+
+var ErrPhonesExhausted = errors.New("phone generator exhausted")
+
+// 手机号生成器，并发安全
+type PhoneGenerator interface {
+	Next() (string, error)
+	Close() error
+}
+
+func NewPhoneGenerator(cfg *config.PhoneGeneratorConfig) (PhoneGenerator, error) {
+	switch cfg.Type {
+	case "range":
+		return newRangePhoneGenerator(cfg)
+	case "prefix":
+		return newPrefixPhoneGenerator(cfg)
+	case "file":
+		return newFilePhoneGenerator(cfg)
+	}
+	return nil, fmt.Errorf("invalid phone generator type: %s", cfg.Type)
+}
+
+// =====================Range=====================
+// 号段区间内顺序或随机取号，顺序取号到达结束号码后从头循环
+type rangePhoneGenerator struct {
+	start  uint64
+	size   uint64
+	random bool
+	count  uint64
+}
+
+func newRangePhoneGenerator(cfg *config.PhoneGeneratorConfig) (*rangePhoneGenerator, error) {
+	if cfg.End < cfg.Start || cfg.Start == 0 {
+		return nil, errors.New("invalid phone range")
+	}
+	return &rangePhoneGenerator{
+		start:  cfg.Start,
+		size:   cfg.End - cfg.Start + 1,
+		random: cfg.Random,
+	}, nil
+}
+
+func (g *rangePhoneGenerator) Next() (string, error) {
+	var offset uint64
+	if g.random {
+		offset = uint64(rand.Int63n(int64(g.size)))
+	} else {
+		offset = (atomic.AddUint64(&g.count, 1) - 1) % g.size
+	}
+	return strconv.FormatUint(g.start+offset, 10), nil
+}
+
+func (g *rangePhoneGenerator) Close() error {
+	return nil
+}
+
+// =====================Range=====================
+
+// =====================Prefix=====================
+// 按权重选择号段，其余位随机生成
+type prefixPhoneGenerator struct {
+	prefixes    []string
+	cumulative  []uint
+	totalWeight uint
+	length      int
+}
+
+func newPrefixPhoneGenerator(cfg *config.PhoneGeneratorConfig) (*prefixPhoneGenerator, error) {
+	if cfg.Prefixes == nil || len(*cfg.Prefixes) == 0 {
+		return nil, errors.New("phone prefixes can't be empty")
+	}
+	g := &prefixPhoneGenerator{length: cfg.Length}
+	if g.length == 0 {
+		g.length = defaultPhoneLength
+	}
+	for _, p := range *cfg.Prefixes {
+		if len(p.Prefix) >= g.length {
+			return nil, fmt.Errorf("phone prefix %s is too long", p.Prefix)
+		}
+		weight := p.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		g.totalWeight += weight
+		g.prefixes = append(g.prefixes, p.Prefix)
+		g.cumulative = append(g.cumulative, g.totalWeight)
+	}
+	return g, nil
+}
+
+func (g *prefixPhoneGenerator) Next() (string, error) {
+	w := uint(rand.Int63n(int64(g.totalWeight)))
+	prefix := g.prefixes[len(g.prefixes)-1]
+	for i, c := range g.cumulative {
+		if w < c {
+			prefix = g.prefixes[i]
+			break
+		}
+	}
+
+	var b strings.Builder
+	b.Grow(g.length)
+	b.WriteString(prefix)
+	for i := len(prefix); i < g.length; i++ {
+		b.WriteByte(byte('0' + rand.Intn(10)))
+	}
+	return b.String(), nil
+}
+
+func (g *prefixPhoneGenerator) Close() error {
+	return nil
+}
+
+// =====================Prefix=====================
+
+// =====================File=====================
+// 从文件中流式读取号码，不一次性加载到内存；支持每行一个号码或 CSV 指定列
+type filePhoneGenerator struct {
+	lock   sync.Mutex
+	path   string
+	column int
+	loop   bool
+	file   *os.File
+	reader *csv.Reader
+}
+
+func newFilePhoneGenerator(cfg *config.PhoneGeneratorConfig) (*filePhoneGenerator, error) {
+	g := &filePhoneGenerator{
+		path:   cfg.File,
+		column: cfg.Column,
+		loop:   cfg.Loop,
+	}
+	if err := g.open(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *filePhoneGenerator) open() error {
+	f, err := os.Open(g.path)
+	if err != nil {
+		return err
+	}
+	r := csv.NewReader(bufio.NewReaderSize(f, 64*1024))
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	r.TrimLeadingSpace = true
+	g.file = f
+	g.reader = r
+	return nil
+}
+
+func (g *filePhoneGenerator) Next() (string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.reader == nil {
+		return "", ErrPhonesExhausted
+	}
+
+	rewound := false
+	for {
+		record, err := g.reader.Read()
+		if err == io.EOF {
+			g.file.Close()
+			g.reader = nil
+			// 空文件循环读取时避免死循环
+			if !g.loop || rewound {
+				return "", ErrPhonesExhausted
+			}
+			if err := g.open(); err != nil {
+				return "", err
+			}
+			rewound = true
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if g.column >= len(record) {
+			continue
+		}
+		phone := strings.TrimSpace(record[g.column])
+		// 跳过空行及表头等非数字行
+		if phone == "" || !isDigits(phone) {
+			continue
+		}
+		return phone, nil
+	}
+}
+
+func (g *filePhoneGenerator) Close() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.reader == nil {
+		return nil
+	}
+	g.reader = nil
+	return g.file.Close()
+}
+
+// 号码只能包含数字，允许 + 开头
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if i == 0 && s[i] == '+' && len(s) > 1 {
+			continue
+		}
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// =====================File=====================
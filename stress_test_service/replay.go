@@ -0,0 +1,268 @@
+package stress_test_service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mock-cmpp-stress-test/cmpp/pkg"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	replayName         = "replay"
+	defaultReplaySpeed = 1.0
+	// 未配置 loop_gap 且无法按平均间隔计算时的循环间隔，单位毫秒
+	defaultReplayLoopGap = 1000.0
+)
+
+// 流量回放：流式读取文件，第 k 条记录在开始后 (offset_k - offset_0) / speed 毫秒发送，保持原始发送间隔
+// 记录的 account 为空时发送至 accounts 匹配的连接；账号没有可用连接时跳过该记录
+type replayer struct {
+	st     *StressTest
+	cfg    *config.ReplayConfig
+	source *fileMessageSource
+	speed  float64
+
+	defaults *workerTargets
+	accounts map[string]*workerTargets
+
+	scheduled uint64
+	sent      uint64
+	skipped   uint64
+	unordered uint64 // 时间偏移小于上一条的记录数，立即发送
+	maxLag    time.Duration
+}
+
+type replayJob struct {
+	client *pkg.CmppClientManager
+	msg    *config.TextMessages
+}
+
+func (st *StressTest) newReplayer() (*replayer, error) {
+	cfg := st.cfg.Replay
+	if cfg.Speed < 0 {
+		return nil, errors.New("replay speed can't be negative")
+	}
+	if err := validateWorkerAccounts(cfg.Accounts); err != nil {
+		return nil, err
+	}
+	source, err := newFileMessageSource(&config.MessageFileConfig{File: cfg.File, Format: cfg.Format})
+	if err != nil {
+		return nil, err
+	}
+	accounts := cfg.Accounts
+	if len(accounts) == 0 {
+		accounts = []config.WorkerAccount{{Name: "*"}}
+	}
+	r := &replayer{
+		st:       st,
+		cfg:      cfg,
+		source:   source,
+		speed:    cfg.Speed,
+		defaults: newWorkerTargets(config.StressTestWorker{Name: replayName, Accounts: accounts}),
+		accounts: make(map[string]*workerTargets),
+	}
+	if r.speed == 0 {
+		r.speed = defaultReplaySpeed
+	}
+	return r, nil
+}
+
+// 记录中的账号对应的连接，用户名按 *_{username} 匹配
+func (r *replayer) targets(account string) *workerTargets {
+	if account == "" {
+		return r.defaults
+	}
+	t, ok := r.accounts[account]
+	if !ok {
+		pattern := account
+		if !strings.Contains(account, "_") {
+			pattern = "*_" + account
+		}
+		t = newWorkerTargets(config.StressTestWorker{Name: account, Accounts: []config.WorkerAccount{{Name: pattern}}})
+		if t.Refresh(r.st.Logger); t.Len() == 0 {
+			r.st.Logger.Warn("Stress Test Replay No Available Client", zap.String("Account", account))
+		}
+		r.accounts[account] = t
+	}
+	return t
+}
+
+func (r *replayer) refresh() {
+	r.defaults.Refresh(r.st.Logger)
+	for _, t := range r.accounts {
+		t.Refresh(r.st.Logger)
+	}
+}
+
+// 两轮之间的间隔：优先使用配置，否则为本轮 span 毫秒内 records 条记录的平均间隔
+func (r *replayer) loopGap(span float64, records uint64) float64 {
+	if r.cfg.LoopGap > 0 {
+		return float64(r.cfg.LoopGap)
+	}
+	if records > 1 && span > 0 {
+		return span / float64(records-1)
+	}
+	return defaultReplayLoopGap
+}
+
+func (r *replayer) Run(ctx context.Context) {
+	logger := r.st.Logger
+	defer r.source.Close()
+
+	senders := r.cfg.Senders
+	if senders == 0 {
+		senders = defaultSenders
+	}
+	jobs := make(chan replayJob, senders*64)
+	var wg sync.WaitGroup
+	for i := uint(0); i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := submit(job.client, job.msg); err != nil {
+					continue
+				}
+				atomic.AddUint64(&r.sent, 1)
+			}
+		}()
+	}
+
+	start := time.Now()
+	var deadline time.Time
+	if r.cfg.Duration > 0 {
+		deadline = start.Add(time.Duration(r.cfg.Duration) * time.Second)
+	}
+	r.refresh()
+	logger.Info("Stress Test Replay Start",
+		zap.String("File", r.cfg.File),
+		zap.Float64("Speed", r.speed),
+		zap.Bool("Loop", r.cfg.Loop))
+
+	// first 为第一条记录的时间偏移，passFirst 为本轮第一条记录的时间偏移
+	// 循环时下一轮的偏移加上 shift，第一条在上一轮最后一条之后间隔 loopGap 发送
+	var first, last, shift, passFirst float64
+	started, passStarted := false, false
+	lastReport, lastSent := start, uint64(0)
+	// 创建时停止定时器，不需要等待的记录不读取 timer.C，避免遗留的触发使下一条记录提前发送
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+loop:
+	for {
+		msg, err := r.source.read()
+		if err == io.EOF {
+			if !r.cfg.Loop || r.source.records == 0 {
+				break
+			}
+			shift = last + r.loopGap(last-passFirst, r.source.records) - first
+			passStarted = false
+			if err := r.source.open(); err != nil {
+				logger.Error("Stress Test Replay Open Error", zap.Error(err))
+				break
+			}
+			continue
+		}
+		if err != nil {
+			logger.Error("Stress Test Replay Read Error", zap.Error(err))
+			break
+		}
+
+		offset := msg.Offset + shift
+		if !started {
+			first, last, started = offset, offset, true
+		}
+		if offset < last {
+			r.unordered++
+			offset = last
+		}
+		last = offset
+		if !passStarted {
+			passFirst, passStarted = offset, true
+		}
+		due := start.Add(time.Duration((offset - first) / r.speed * float64(time.Millisecond)))
+		if !deadline.IsZero() && due.After(deadline) {
+			break
+		}
+
+		if wait := time.Until(due); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				break loop
+			}
+		} else if ctx.Err() != nil {
+			break
+		}
+		if lag := time.Since(due); lag > r.maxLag {
+			r.maxLag = lag
+		}
+
+		if now := time.Now(); now.Sub(lastReport) >= reportInterval {
+			sent := atomic.LoadUint64(&r.sent)
+			logger.Info("Stress Test Replay Rate",
+				zap.Float64("Achieved", float64(sent-lastSent)/now.Sub(lastReport).Seconds()),
+				zap.Duration("Lag", time.Since(due)),
+				zap.Uint64("Total", sent),
+				zap.Uint64("Skipped", r.skipped))
+			lastReport, lastSent = now, sent
+			r.refresh()
+		}
+
+		// 连接断开或重连时立即重新匹配，仍没有可用连接时跳过该记录
+		t := r.targets(msg.Account)
+		c := t.Next()
+		if c == nil && t.Refresh(logger) {
+			c = t.Next()
+		}
+		if c == nil {
+			r.skipped++
+			continue
+		}
+		m := msg.TextMessages
+		select {
+		case jobs <- replayJob{client: c, msg: &m}:
+			r.scheduled++
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	end := time.Now()
+	elapsed := end.Sub(start)
+	var achieved float64
+	if elapsed > 0 {
+		achieved = float64(r.sent) / elapsed.Seconds()
+	}
+	logger.Info("Stress Test Replay Done",
+		zap.Uint64("Scheduled", r.scheduled),
+		zap.Uint64("Sent", r.sent),
+		zap.Uint64("Skipped", r.skipped),
+		zap.Uint64("Unordered", r.unordered),
+		zap.Duration("Elapsed", elapsed),
+		zap.Float64("Achieved", achieved),
+		zap.Duration("MaxLag", r.maxLag))
+	statistics.CollectService.Workers.Add(statistics.WorkerSummary{
+		Name:      replayName,
+		Scheduled: r.scheduled,
+		Sent:      r.sent,
+		ElapsedS:  elapsed.Seconds(),
+		Achieved:  achieved,
+		MaxLagMs:  float64(r.maxLag) / float64(time.Millisecond),
+	}, start, end)
+}
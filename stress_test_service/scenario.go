@@ -0,0 +1,132 @@
+package stress_test_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mock-cmpp-stress-test/cmpp/client"
+	"mock-cmpp-stress-test/cmpp/pkg"
+	"mock-cmpp-stress-test/config"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 启动前校验场景配置
+func (st *StressTest) validateScenario() error {
+	sc := st.cfg.Scenario
+	if len(sc.Phases) == 0 {
+		return errors.New("scenario has no phases")
+	}
+	if cfg := config.ConfigObj.ClientConfig; cfg == nil || !cfg.Enable {
+		return errors.New("scenario requires cmpp client enabled")
+	}
+	for i, phase := range sc.Phases {
+		switch phase.Action {
+		case "connect", "disconnect", "pause", "wait_reports", "server":
+		case "run":
+			if len(phase.Workers) == 0 {
+				return fmt.Errorf("scenario phase %d has no workers", i)
+			}
+			for _, worker := range phase.Workers {
+				if _, _, err := st.prepareWorker(worker); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("scenario phase %d invalid action: %s", i, phase.Action)
+		}
+	}
+	return nil
+}
+
+// 按顺序执行场景各阶段，某一阶段出错时终止
+func (st *StressTest) RunScenario() {
+	sc := st.cfg.Scenario
+	cc := new(client.CmppClient)
+	cc.Init(st.Logger)
+
+	start := time.Now()
+	st.Logger.Info("Stress Test Scenario Start", zap.String("Name", sc.Name), zap.Int("Phases", len(sc.Phases)))
+	for i, phase := range sc.Phases {
+		if st.ctx.Err() != nil {
+			st.Logger.Warn("Stress Test Scenario Canceled", zap.String("Name", sc.Name), zap.Int("Index", i))
+			return
+		}
+		phaseStart := time.Now()
+		st.Logger.Info("Stress Test Scenario Phase Start",
+			zap.Int("Index", i),
+			zap.String("Name", phase.Name),
+			zap.String("Action", phase.Action))
+		if err := st.runPhase(cc, phase); err != nil {
+			st.Logger.Error("Stress Test Scenario Phase Error",
+				zap.Int("Index", i),
+				zap.String("Name", phase.Name),
+				zap.String("Action", phase.Action),
+				zap.Error(err))
+			return
+		}
+		st.Logger.Info("Stress Test Scenario Phase Done",
+			zap.Int("Index", i),
+			zap.String("Name", phase.Name),
+			zap.String("Action", phase.Action),
+			zap.Duration("Elapsed", time.Since(phaseStart)))
+	}
+	st.Logger.Info("Stress Test Scenario Done", zap.String("Name", sc.Name), zap.Duration("Elapsed", time.Since(start)))
+}
+
+func (st *StressTest) runPhase(cc *client.CmppClient, phase config.ScenarioPhase) error {
+	switch phase.Action {
+	case "connect":
+		return cc.ConnectAccounts(phase.Accounts)
+	case "run":
+		return st.RunWorkers(st.ctx, phase.Workers)
+	case "pause":
+		st.sleep(time.Duration(phase.Duration) * time.Second)
+	case "wait_reports":
+		st.waitReports(phase.Timeout)
+	case "server":
+		b := pkg.SetServerBehavior(phase.Server)
+		st.Logger.Info("Stress Test Scenario Server Behavior",
+			zap.Uint32("SubmitResult", b.SubmitResult),
+			zap.Float64("SubmitErrorRate", b.SubmitErrorRate),
+			zap.Duration("SubmitDelay", b.SubmitDelay),
+			zap.String("ReportStat", b.ReportStat),
+			zap.Float64("ReportDropRate", b.ReportDropRate),
+			zap.Duration("ReportDelay", b.ReportDelay))
+	case "disconnect":
+		cc.DisconnectAccounts(phase.Accounts)
+	}
+	return nil
+}
+
+// 同时启动一组压测线程并等待全部结束，ctx 取消时提前结束
+func (st *StressTest) RunWorkers(ctx context.Context, workers []config.StressTestWorker) error {
+	if pkg.ClientCount() == 0 {
+		return errors.New("cmpp clients have no available")
+	}
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		worker, profile, err := st.prepareWorker(worker)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st.StartWorker(ctx, worker, profile)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (st *StressTest) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-st.ctx.Done():
+	}
+}
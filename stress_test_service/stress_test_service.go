@@ -7,14 +7,12 @@ import (
 	"mock-cmpp-stress-test/cmpp/pkg"
 	"mock-cmpp-stress-test/config"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	cmpp "github.com/bigwhite/gocmpp"
 	"go.uber.org/zap"
 )
 
-const defaultConcurrency = 1000
+const defaultWaitTimeout = 300
 
 type StressTest struct {
 	cfg    *config.StressTestConfig
@@ -22,12 +20,27 @@ type StressTest struct {
 
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	source MessageSource
+	phones PhoneGenerator
+	seq    uint64
+
+	// 压测线程（或场景）全部结束且等待响应、状态报告完成后关闭
+	done chan struct{}
+
+	agent *agent
 }
 
 func (st *StressTest) Init(log *zap.Logger) {
 	st.cfg = config.ConfigObj.StressTest
 	st.Logger = log
 	st.ctx, st.cancel = context.WithCancel(context.Background())
+	st.done = make(chan struct{})
+}
+
+// 启用 auto_exit 时，压测完成后关闭
+func (st *StressTest) Done() <-chan struct{} {
+	return st.done
 }
 
 func (st *StressTest) Start() error {
@@ -35,146 +48,209 @@ func (st *StressTest) Start() error {
 		return nil
 	}
 
-	if len(pkg.Clients) == 0 {
+	scenario := st.cfg.ScenarioEnabled()
+	mode := st.cfg.DistributedMode()
+	// coordinator 不使用本进程的客户端，下发压测线程后等待 agent 结束
+	if mode == "coordinator" {
+		if err := st.validateCoordinator(); err != nil {
+			st.Logger.Error("Stress Test Coordinator Config Error", zap.Error(err))
+			return err
+		}
+		go func() {
+			if err := st.RunCoordinator(); err != nil {
+				st.Logger.Error("Stress Test Coordinator Error", zap.Error(err))
+			}
+			st.complete()
+		}()
+		return nil
+	}
+	if pkg.ClientCount() == 0 && !scenario {
 		err := errors.New("cmpp clients have no available")
 		st.Logger.Error("Stress Test Start Error", zap.Error(err))
 		return err
 	}
 
-	for _, worker := range *st.cfg.Workers {
-		if worker.DurationTime == 0 && worker.TotalNum == 0 {
-			err := errors.New("DurationTime and TotalNum can't be 0 at once")
-			st.Logger.Error("Stress Test Worker Config Error", zap.Error(err))
+	// 流量回放按文件发送，不使用 messages 及 workers
+	if st.cfg.Replay != nil && st.cfg.Replay.Enable {
+		if scenario || mode == "agent" {
+			err := errors.New("replay can't be used with scenario or distributed agent")
+			st.Logger.Error("Stress Test Replay Config Error", zap.Error(err))
 			return err
 		}
+		r, err := st.newReplayer()
+		if err != nil {
+			st.Logger.Error("Stress Test Replay Config Error", zap.Error(err))
+			return err
+		}
+		go func() {
+			r.Run(st.ctx)
+			st.complete()
+		}()
+		return nil
+	}
 
-		time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
+	source, err := NewMessageSource(st.cfg)
+	if err != nil {
+		st.Logger.Error("Stress Test Message Source Error", zap.Error(err))
+		return err
+	}
+	st.source = source
 
-		if worker.TotalNum != 0 {
-			go st.StartWorkerByTotalNum(worker)
-			continue
+	if st.cfg.Phones != nil && st.cfg.Phones.Enable {
+		phones, err := NewPhoneGenerator(st.cfg.Phones)
+		if err != nil {
+			st.Logger.Error("Stress Test Phone Generator Error", zap.Error(err))
+			return err
 		}
+		st.phones = phones
+	}
 
-		if worker.DurationTime != 0 {
-			go st.StartWorkerByDurationTime(worker)
-			continue
+	// agent 等待 coordinator 下发压测线程
+	if mode == "agent" {
+		if err := st.startAgent(); err != nil {
+			st.Logger.Error("Stress Test Agent Start Error", zap.Error(err))
+			return err
 		}
+		return nil
 	}
 
-	return nil
-}
+	if scenario {
+		if err := st.validateScenario(); err != nil {
+			st.Logger.Error("Stress Test Scenario Config Error", zap.Error(err))
+			return err
+		}
+		go func() {
+			st.RunScenario()
+			st.complete()
+		}()
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for _, worker := range *st.cfg.Workers {
+		worker, profile, err := st.prepareWorker(worker)
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st.StartWorker(st.ctx, worker, profile)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		st.complete()
+	}()
 
-func (st *StressTest) Stop() error {
-	st.cancel()
-	st.Logger.Info("Stress Test Stop Success")
 	return nil
 }
 
-func (st *StressTest) StartWorkerByDurationTime(worker config.StressTestWorker) {
-	_, ok := pkg.Clients[worker.Name]
-	if !ok {
-		st.Logger.Error("[StressTest][StartWorkerByDurationTime] Error", zap.Error(errors.New("can't find cmpp client")))
+// 压测结束：启用 auto_exit 时等待响应及状态报告后通知退出
+func (st *StressTest) complete() {
+	if !st.cfg.AutoExit || st.ctx.Err() != nil {
 		return
 	}
+	st.Logger.Info("Stress Test Complete, Waiting Reports")
+	st.waitReports(st.cfg.WaitTimeout)
+	close(st.done)
+}
 
-	concurrency := worker.Concurrency
-	// 每个 worker 每秒最多发送 1000 个数据包，避免发不完，达不到并发量
-	if worker.Concurrency > defaultConcurrency {
-		concurrency = defaultConcurrency
+// 等待所有连接的提交包响应及状态报告，timeout 单位秒，超时后继续
+func (st *StressTest) waitReports(timeout uint) {
+	if timeout == 0 {
+		timeout = defaultWaitTimeout
 	}
-	workerNum := worker.Concurrency / concurrency
-	if workerNum == 0 {
-		workerNum = 1
-	}
-	count := uint64(0)
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	tk := time.NewTicker(reportInterval)
+	defer tk.Stop()
 
-	for count < worker.DurationTime {
+	for {
+		var queued, waitSubmitResp, waitReports int64
+		for _, c := range pkg.ClientsSnapshot() {
+			q, s, r := c.PendingCount()
+			queued, waitSubmitResp, waitReports = queued+q, waitSubmitResp+s, waitReports+r
+		}
+		if queued <= 0 && waitSubmitResp <= 0 && waitReports <= 0 {
+			return
+		}
+		if !time.Now().Before(deadline) {
+			st.Logger.Warn("Stress Test Wait Reports Timeout",
+				zap.Int64("Queued", queued),
+				zap.Int64("WaitSubmitResp", waitSubmitResp),
+				zap.Int64("WaitReports", waitReports))
+			return
+		}
 		select {
-		case <-ticker.C:
-			// 重新获取，可能重连
-			c, _ := pkg.Clients[worker.Name]
-			st.Logger.Info("Stress Test Ticker Duration Time", zap.Uint64("DurationTime", count))
-			for i := uint64(0); i < workerNum; i++ {
-				go func(id uint64) {
-					for sendNum := uint64(0); sendNum < concurrency; sendNum++ {
-						for _, msg := range *st.cfg.Messages {
-							if c.Version == cmpp.V20 || c.Version == cmpp.V21 {
-								c.Cmpp2Submit(&msg)
-							} else if c.Version == cmpp.V30 {
-								c.Cmpp3Submit(&msg)
-							}
-						}
-					}
-				}(i)
-				if worker.Sleep > 0 {
-					time.Sleep(time.Duration(worker.Sleep) * time.Millisecond)
-				}
-			}
-			atomic.AddUint64(&count, 1)
+		case <-tk.C:
 		case <-st.ctx.Done():
 			return
 		}
 	}
 }
 
-func (st *StressTest) StartWorkerByTotalNum(worker config.StressTestWorker) {
-	_, ok := pkg.Clients[worker.Name]
-	if !ok {
-		st.Logger.Error("[StressTest][StartWorkerByTotalNum] Error", zap.Error(errors.New("can't find cmpp client")))
-		return
+func (st *StressTest) validateCoordinator() error {
+	if len(st.cfg.Distributed.Agents) == 0 {
+		return errors.New("coordinator agents can't be empty")
 	}
-
-	concurrency := worker.Concurrency
-	// 每个 worker 每秒最多发送 1000 个数据包，避免发不完，达不到并发量
-	if worker.Concurrency > defaultConcurrency {
-		concurrency = defaultConcurrency
+	if st.cfg.Workers == nil || len(*st.cfg.Workers) == 0 {
+		return errors.New("coordinator workers can't be empty")
 	}
-	workerNum := worker.Concurrency / concurrency
-	if workerNum == 0 {
-		workerNum = 1
+	for _, worker := range *st.cfg.Workers {
+		if worker.Capacity != nil && worker.Capacity.Enable {
+			return errors.New("capacity search can't be distributed")
+		}
+		if _, _, err := st.prepareWorker(worker); err != nil {
+			return err
+		}
 	}
-	total := uint64(0)
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	return nil
+}
 
-	var mutex sync.Mutex
+// 校验压测线程配置，未配置持续时间和总数时按负载曲线的自然持续时间运行
+// profile、adaptive、capacity 都会改变发送速率，只能启用其中一项
+func (st *StressTest) prepareWorker(worker config.StressTestWorker) (config.StressTestWorker, LoadProfile, error) {
+	profile, err := NewLoadProfile(worker)
+	if err != nil {
+		st.Logger.Error("Stress Test Worker Config Error", zap.Error(err), zap.String("Name", worker.Name))
+		return worker, nil, err
+	}
+	if err := validateWorkerAccounts(worker.Accounts); err != nil {
+		st.Logger.Error("Stress Test Worker Config Error", zap.Error(err), zap.String("Name", worker.Name))
+		return worker, nil, err
+	}
+	adaptive := worker.Adaptive != nil && worker.Adaptive.Enable
+	capacity := worker.Capacity != nil && worker.Capacity.Enable
+	if (profile != nil && adaptive) || (capacity && (profile != nil || adaptive)) {
+		err := errors.New("profile, adaptive and capacity can't be enabled at once")
+		st.Logger.Error("Stress Test Worker Config Error", zap.Error(err), zap.String("Name", worker.Name))
+		return worker, nil, err
+	}
+	if worker.DurationTime == 0 && worker.TotalNum == 0 && profile != nil {
+		worker.DurationTime = uint64(profile.Duration() / time.Second)
+	}
+	// 容量探测在查找结束后停止，可不配置持续时间和总数
+	if worker.DurationTime == 0 && worker.TotalNum == 0 && !capacity {
+		err := errors.New("DurationTime and TotalNum can't be 0 at once")
+		st.Logger.Error("Stress Test Worker Config Error", zap.Error(err))
+		return worker, nil, err
+	}
+	return worker, profile, nil
+}
 
-	for total < worker.TotalNum {
-		select {
-		case <-ticker.C:
-			st.Logger.Info("Stress Test Ticker Total", zap.Uint64("Total", total))
-			c, _ := pkg.Clients[worker.Name]
-			for i := uint64(0); i < workerNum; i++ {
-				if total >= worker.TotalNum {
-					return
-				}
-
-				go func(id uint64) {
-					for sendNum := uint64(0); sendNum < concurrency; sendNum++ {
-						for _, msg := range *st.cfg.Messages {
-							mutex.Lock()
-							atomic.AddUint64(&total, 1)
-							if atomic.LoadUint64(&total) >= worker.TotalNum+1 {
-								return
-							}
-							mutex.Unlock()
-							st.Logger.Info("Stress Test Worker Start", zap.Uint64("WorkerNum", id), zap.Uint64("Total", total))
-							if c.Version == cmpp.V20 || c.Version == cmpp.V21 {
-								c.Cmpp2Submit(&msg)
-							} else if c.Version == cmpp.V30 {
-								c.Cmpp3Submit(&msg)
-							}
-						}
-					}
-				}(i)
-				if worker.Sleep > 0 {
-					time.Sleep(time.Duration(worker.Sleep) * time.Millisecond)
-				}
-			}
-		case <-st.ctx.Done():
-			return
-		}
+func (st *StressTest) Stop() error {
+	st.cancel()
+	if st.agent != nil {
+		st.agent.Stop()
 	}
+	if st.source != nil {
+		st.source.Close()
+	}
+	if st.phones != nil {
+		st.phones.Close()
+	}
+	st.Logger.Info("Stress Test Stop Success")
+	return nil
 }
@@ -0,0 +1,162 @@
+package stress_test_service
+
+import (
+	"mock-cmpp-stress-test/cmpp/pkg"
+	"mock-cmpp-stress-test/config"
+	"path"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// 压测线程发送的连接集合，按权重平滑轮询（smooth weighted round-robin）选择连接
+// 每个上报周期重新匹配已连接的客户端，账号断开、重连或新连接后按剩余连接的权重重新分配
+type workerTargets struct {
+	name     string
+	accounts []config.WorkerAccount
+
+	conns      []*targetConn
+	generation uint64 // 连接集合变化时递增，用于重新取网关反馈基准值
+}
+
+type targetConn struct {
+	key     string
+	client  *pkg.CmppClientManager
+	weight  float64
+	current float64
+}
+
+func newWorkerTargets(worker config.StressTestWorker) *workerTargets {
+	return &workerTargets{name: worker.Name, accounts: worker.Accounts}
+}
+
+// 校验账号通配符
+func validateWorkerAccounts(accounts []config.WorkerAccount) error {
+	for _, account := range accounts {
+		if _, err := path.Match(account.Name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 未配置 accounts 时只匹配 name 对应的连接；否则按 {ip}:{port}_{username} 匹配账号，返回首个匹配账号的权重
+func (t *workerTargets) match(key string) (uint, bool) {
+	if len(t.accounts) == 0 {
+		return 1, key == t.name
+	}
+	baseKey := strings.SplitN(key, "#", 2)[0]
+	for _, account := range t.accounts {
+		if ok, _ := path.Match(account.Name, baseKey); ok || account.Name == baseKey {
+			if account.Weight == 0 {
+				return 1, true
+			}
+			return account.Weight, true
+		}
+	}
+	return 0, false
+}
+
+// 重新匹配已连接的客户端，连接集合变化时返回 true
+func (t *workerTargets) Refresh(logger *zap.Logger) bool {
+	weights := make(map[string]uint)
+	conns := make(map[string][]*pkg.CmppClientManager)
+	for key, c := range pkg.ClientsSnapshot() {
+		if !c.IsConnected() || c.IsDraining() {
+			continue
+		}
+		weight, ok := t.match(key)
+		if !ok {
+			continue
+		}
+		baseKey := strings.SplitN(key, "#", 2)[0]
+		weights[baseKey] = weight
+		conns[baseKey] = append(conns[baseKey], c)
+	}
+
+	targets := make([]*targetConn, 0, len(t.conns))
+	for baseKey, cs := range conns {
+		for _, c := range cs {
+			targets = append(targets, &targetConn{
+				key:    c.Key,
+				client: c,
+				weight: float64(weights[baseKey]) / float64(len(cs)),
+			})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].key < targets[j].key })
+
+	if t.equal(targets) {
+		return false
+	}
+	t.conns = targets
+	t.generation++
+	if len(targets) == 0 {
+		logger.Warn("Stress Test Worker No Available Client", zap.String("Name", t.name))
+	} else {
+		logger.Info("Stress Test Worker Targets",
+			zap.String("Name", t.name),
+			zap.Int("Accounts", len(conns)),
+			zap.Int("Connections", len(targets)))
+	}
+	return true
+}
+
+func (t *workerTargets) equal(targets []*targetConn) bool {
+	if len(targets) != len(t.conns) {
+		return false
+	}
+	for i, tc := range targets {
+		if tc.client != t.conns[i].client || tc.weight != t.conns[i].weight {
+			return false
+		}
+	}
+	return true
+}
+
+// 可发送的连接数
+func (t *workerTargets) Len() int {
+	return len(t.conns)
+}
+
+// 按权重选择下一个连接，跳过上次匹配后断开或排空中的连接，没有可用连接时返回 nil
+func (t *workerTargets) Next() *pkg.CmppClientManager {
+	var best *targetConn
+	var total float64
+	for _, tc := range t.conns {
+		if tc.weight == 0 {
+			continue
+		}
+		if !tc.client.IsConnected() || tc.client.IsDraining() {
+			tc.weight = 0
+			continue
+		}
+		tc.current += tc.weight
+		total += tc.weight
+		if best == nil || tc.current > best.current {
+			best = tc
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.current -= total
+	return best.client
+}
+
+// 所有连接的网关反馈累计值之和
+func (t *workerTargets) Feedback() pkg.SubmitFeedback {
+	var sum pkg.SubmitFeedback
+	for _, tc := range t.conns {
+		fb := tc.client.Feedback()
+		sum.Success += fb.Success
+		sum.Failed += fb.Failed
+		sum.FlowControl += fb.FlowControl
+		sum.Timeout += fb.Timeout
+		sum.LatencySum += fb.LatencySum
+		sum.Reports += fb.Reports
+		sum.ReportLatencySum += fb.ReportLatencySum
+	}
+	return sum
+}
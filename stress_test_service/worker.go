@@ -0,0 +1,300 @@
+package stress_test_service
+
+import (
+	"context"
+	"errors"
+	"mock-cmpp-stress-test/cmpp/pkg"
+	"mock-cmpp-stress-test/cmpp/server"
+	"mock-cmpp-stress-test/config"
+	"mock-cmpp-stress-test/statistics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cmpp "github.com/bigwhite/gocmpp"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSenders  = 16
+	reportInterval  = 1 * time.Second
+	profileInterval = 100 * time.Millisecond
+)
+
+// 压测线程结果
+type WorkerResult struct {
+	Name      string
+	Target    uint64        // 目标每秒发送量
+	Scheduled uint64        // 已调度的短信数
+	Sent      uint64        // 已提交给客户端的短信数
+	Elapsed   time.Duration // 实际持续时间
+	MaxLag    time.Duration // 最大调度延迟
+}
+
+func (r *WorkerResult) Rate() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Sent) / r.Elapsed.Seconds()
+}
+
+// 开环匀速发送：第 k 条短信的计划发送时间为 base + k/rate，与网关响应快慢无关
+// 调度协程按计划时间把短信交给发送协程，发送协程来不及处理时调度延迟（lag）增大
+// 配置负载曲线时每 100ms 按曲线重新计算速率，速率为 0 时暂停发送
+// 配置多个账号时按权重轮询发送，每秒重新匹配连接，账号断开时速率分配至剩余连接，全部断开时暂停发送
+func (st *StressTest) StartWorker(ctx context.Context, worker config.StressTestWorker, profile LoadProfile) {
+	targets := newWorkerTargets(worker)
+	if targets.Refresh(st.Logger); targets.Len() == 0 {
+		st.Logger.Error("[StressTest][StartWorker] Error", zap.Error(errors.New("can't find cmpp client")), zap.String("Name", worker.Name))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := &WorkerResult{Name: worker.Name, Target: worker.Concurrency}
+	rc := newRateController(worker)
+	cs := newCapacitySearch(worker)
+	rate := worker.Concurrency
+	if rc != nil {
+		rate = rc.Rate()
+	}
+	if cs != nil {
+		rate = cs.Rate()
+	}
+	if profile != nil {
+		rate = profile.Rate(0)
+	} else if rate == 0 {
+		rate = 1
+	}
+
+	senders := worker.Senders
+	if senders == 0 {
+		senders = defaultSenders
+	}
+	jobs := make(chan *pkg.CmppClientManager, senders*64)
+	var wg sync.WaitGroup
+	for i := uint(0); i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				// 已停止时丢弃剩余任务
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := st.sendMessage(c, worker.Name); err != nil {
+					if errors.Is(err, ErrMessagesExhausted) || errors.Is(err, ErrPhonesExhausted) {
+						cancel()
+					}
+					continue
+				}
+				atomic.AddUint64(&result.Sent, 1)
+			}
+		}()
+	}
+
+	start := time.Now()
+	var deadline time.Time
+	if worker.TotalNum == 0 && worker.DurationTime > 0 {
+		deadline = start.Add(time.Duration(worker.DurationTime) * time.Second)
+	}
+	// 速率变化时以当前时间、已调度数量为新的基准
+	base, baseCount := start, uint64(0)
+	dueTime := func(k uint64) time.Time {
+		if rate == 0 {
+			return time.Now().Add(profileInterval)
+		}
+		return base.Add(time.Duration(float64(int64(k)-int64(baseCount)) / float64(rate) * float64(time.Second)))
+	}
+	lastReport, lastSent, lastProfile := start, uint64(0), start
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	st.Logger.Info("Stress Test Worker Start",
+		zap.String("Name", worker.Name),
+		zap.Uint64("Rate", rate),
+		zap.Uint64("TotalNum", worker.TotalNum),
+		zap.Uint64("DurationTime", worker.DurationTime))
+
+loop:
+	for {
+		now := time.Now()
+		if worker.TotalNum > 0 && result.Scheduled >= worker.TotalNum {
+			break
+		}
+		if !deadline.IsZero() && !now.Before(deadline) {
+			break
+		}
+
+		if profile != nil && now.Sub(lastProfile) >= profileInterval {
+			lastProfile = now
+			if newRate := profile.Rate(now.Sub(start)); newRate != rate {
+				base, baseCount, rate = now, result.Scheduled, newRate
+			}
+		}
+
+		// 调度所有已到计划时间的短信
+		due := baseCount + uint64(now.Sub(base).Seconds()*float64(rate)) + 1
+		if rate == 0 || targets.Len() == 0 {
+			due = result.Scheduled
+		}
+		if worker.TotalNum > 0 && due > worker.TotalNum {
+			due = worker.TotalNum
+		}
+		// 上次匹配后连接全部断开时立即重新匹配，仍没有可用连接时以当前时间为基准暂停，不补发暂停期间的短信
+		stalled := false
+		for result.Scheduled < due {
+			c := targets.Next()
+			if c == nil && targets.Refresh(st.Logger) {
+				c = targets.Next()
+			}
+			if c == nil {
+				stalled = true
+				base, baseCount = now, result.Scheduled
+				break
+			}
+			select {
+			case jobs <- c:
+				result.Scheduled++
+			case <-ctx.Done():
+				break loop
+			}
+		}
+		if lag := time.Since(dueTime(result.Scheduled - 1)); lag > result.MaxLag {
+			result.MaxLag = lag
+		}
+
+		if now.Sub(lastReport) >= reportInterval {
+			sent := atomic.LoadUint64(&result.Sent)
+			st.Logger.Info("Stress Test Worker Rate",
+				zap.String("Name", worker.Name),
+				zap.Uint64("Target", rate),
+				zap.Float64("Achieved", float64(sent-lastSent)/now.Sub(lastReport).Seconds()),
+				zap.Duration("Lag", time.Since(dueTime(result.Scheduled-1))),
+				zap.Uint64("Total", sent))
+			lastReport, lastSent = now, sent
+
+			// 重新匹配连接，可能重连或断开；恢复发送时以当前时间为基准，不补发暂停期间的短信
+			paused := targets.Len() == 0
+			if targets.Refresh(st.Logger) && paused && targets.Len() > 0 {
+				base, baseCount = now, result.Scheduled
+			}
+			if rc != nil {
+				if newRate := rc.Update(targets, now, st.Logger); newRate != rate && newRate > 0 {
+					base, baseCount, rate = now, result.Scheduled, newRate
+				}
+			}
+			if cs != nil {
+				newRate, done := cs.Update(targets, now, st.Logger)
+				if done {
+					break loop
+				}
+				if newRate != rate {
+					base, baseCount, rate = now, result.Scheduled, newRate
+				}
+			}
+		}
+
+		next := dueTime(result.Scheduled)
+		if profile != nil && next.After(lastProfile.Add(profileInterval)) {
+			next = lastProfile.Add(profileInterval)
+		}
+		// 没有可用连接时按 profileInterval 等待，避免计划时间已过导致空转
+		if stalled || targets.Len() == 0 {
+			next = now.Add(profileInterval)
+		}
+		timer.Reset(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	end := time.Now()
+	result.Elapsed = end.Sub(start)
+	if rc != nil {
+		rc.Report(st.Logger)
+	}
+	if cs != nil {
+		cs.Report(st.Logger)
+	}
+	st.Logger.Info("Stress Test Worker Done",
+		zap.String("Name", result.Name),
+		zap.Uint64("Target", result.Target),
+		zap.Uint64("Scheduled", result.Scheduled),
+		zap.Uint64("Sent", result.Sent),
+		zap.Duration("Elapsed", result.Elapsed),
+		zap.Float64("Achieved", result.Rate()),
+		zap.Duration("MaxLag", result.MaxLag))
+	statistics.CollectService.Workers.Add(statistics.WorkerSummary{
+		Name:      result.Name,
+		Target:    result.Target,
+		Scheduled: result.Scheduled,
+		Sent:      result.Sent,
+		ElapsedS:  result.Elapsed.Seconds(),
+		Achieved:  result.Rate(),
+		MaxLagMs:  float64(result.MaxLag) / float64(time.Millisecond),
+	}, start, end)
+}
+
+// 生成并提交一条短信；混合负载的 mo 类型由本进程的服务端向该连接的账号推送上行短信，query 类型发送 CMPP_QUERY
+func (st *StressTest) sendMessage(c *pkg.CmppClientManager, worker string) error {
+	msg, kind, err := st.nextMessage(c, worker)
+	if err != nil {
+		st.Logger.Error("Stress Test Render Message Error", zap.Error(err))
+		return err
+	}
+	if kind == mixMo {
+		if err := server.MockMo(c.UserName, msg.Phone, msg.Content, msg.Extend); err != nil {
+			st.Logger.Error("Stress Test Mock Mo Error", zap.Error(err), zap.String("UserName", c.UserName))
+			return err
+		}
+		statistics.CollectService.Mix.Add(kind, 0, 1, 0)
+		return nil
+	}
+	if kind == mixQuery {
+		if err := c.SendCmppQueryReq(msg.Content); err != nil {
+			return err
+		}
+		statistics.CollectService.Mix.Add(kind, 1, 0, 0)
+		return nil
+	}
+	if err := submit(c, msg); err != nil {
+		return err
+	}
+	if kind != "" {
+		st.addMix(c, kind, msg)
+	}
+	return nil
+}
+
+// 按连接的协议版本提交短信，生成或发送失败时返回错误，不计入发送数
+func submit(c *pkg.CmppClientManager, msg *config.TextMessages) error {
+	if c.Version == cmpp.V20 || c.Version == cmpp.V21 {
+		return c.Cmpp2Submit(msg)
+	} else if c.Version == cmpp.V30 {
+		return c.Cmpp3Submit(msg)
+	}
+	return errors.New("invalid cmpp version")
+}
+
+// 统计混合负载的提交包数（按连接的 UDH 模式拆分的长短信分段）及号码数，每个提交包的每个号码对应一个状态报告
+func (st *StressTest) addMix(c *pkg.CmppClientManager, kind string, msg *config.TextMessages) {
+	var packets uint64 = 1
+	if segments, err := c.SegmentCount(msg.Content, msg.Encoding); err == nil {
+		packets = uint64(segments)
+	}
+	destinations := uint64(1)
+	if len(msg.Phones) > 0 {
+		destinations = uint64(len(msg.Phones))
+	}
+	var reports uint64
+	if fields, err := c.ResolveSubmitFields(msg); err == nil && fields.RegisteredDelivery != 0 {
+		reports = packets * destinations
+	}
+	statistics.CollectService.Mix.Add(kind, packets, destinations, reports)
+}
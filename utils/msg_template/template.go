@@ -0,0 +1,201 @@
+package msg_template
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 短信模板，支持在内容、手机号中使用变量：
+//
+//	{{seq}}              本次压测全局递增序号，{{seq:8}} 左补 0 至 8 位
+//	{{rand_digits:6}}    6 位随机数字
+//	{{timestamp}}        秒级时间戳，{{timestamp_ms}} 毫秒级时间戳
+//	{{time:15:04:05}}    按 Go 时间格式输出当前时间
+//	{{choice:a|b|c}}     从列表中随机选择一项
+//	{{account}}          发送账号
+//	{{worker}}           压测线程名称
+//	{{pad:0:20}}         随机长度（0~20）的填充字符，{{pad:0:20:测}} 指定填充字符
+//	{{mo_phone}}         自动回复时上行短信的手机号，{{mo_content}} 上行短信内容
+const (
+	leftDelim  = "{{"
+	rightDelim = "}}"
+)
+
+// 模板渲染上下文
+type Context struct {
+	Seq       uint64
+	Account   string
+	Worker    string
+	MoPhone   string
+	MoContent string
+}
+
+type segment func(b *strings.Builder, ctx *Context)
+
+type Template struct {
+	raw      string
+	static   bool
+	segments []segment
+}
+
+// 解析模板，不含变量时渲染直接返回原文
+func Compile(s string) (*Template, error) {
+	t := &Template{raw: s}
+	rest := s
+	for {
+		start := strings.Index(rest, leftDelim)
+		if start == -1 {
+			t.addLiteral(rest)
+			break
+		}
+		end := strings.Index(rest[start:], rightDelim)
+		if end == -1 {
+			return nil, fmt.Errorf("template %q: unclosed %s", s, leftDelim)
+		}
+		t.addLiteral(rest[:start])
+		seg, err := parseVariable(rest[start+len(leftDelim) : start+end])
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %s", s, err.Error())
+		}
+		t.segments = append(t.segments, seg)
+		rest = rest[start+end+len(rightDelim):]
+	}
+	t.static = !strings.Contains(s, leftDelim)
+	return t, nil
+}
+
+// 不解析变量，渲染时原样返回 s
+func Literal(s string) *Template {
+	return &Template{raw: s, static: true}
+}
+
+func (t *Template) addLiteral(s string) {
+	if s == "" {
+		return
+	}
+	t.segments = append(t.segments, func(b *strings.Builder, _ *Context) {
+		b.WriteString(s)
+	})
+}
+
+func (t *Template) Static() bool {
+	return t.static
+}
+
+func (t *Template) Render(ctx *Context) string {
+	if t.static {
+		return t.raw
+	}
+	var b strings.Builder
+	for _, seg := range t.segments {
+		seg(&b, ctx)
+	}
+	return b.String()
+}
+
+func parseVariable(expr string) (segment, error) {
+	name, arg := expr, ""
+	if i := strings.Index(expr, ":"); i != -1 {
+		name, arg = expr[:i], expr[i+1:]
+	}
+	name = strings.TrimSpace(name)
+
+	switch name {
+	case "seq":
+		width := 0
+		if arg != "" {
+			w, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, errors.New("invalid seq width: " + arg)
+			}
+			width = w
+		}
+		return func(b *strings.Builder, ctx *Context) {
+			b.WriteString(fmt.Sprintf("%0*d", width, ctx.Seq))
+		}, nil
+
+	case "rand_digits":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return nil, errors.New("invalid rand_digits length: " + arg)
+		}
+		return func(b *strings.Builder, _ *Context) {
+			for i := 0; i < n; i++ {
+				b.WriteByte(byte('0' + rand.Intn(10)))
+			}
+		}, nil
+
+	case "timestamp":
+		return func(b *strings.Builder, _ *Context) {
+			b.WriteString(strconv.FormatInt(time.Now().Unix(), 10))
+		}, nil
+
+	case "timestamp_ms":
+		return func(b *strings.Builder, _ *Context) {
+			b.WriteString(strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10))
+		}, nil
+
+	case "time":
+		layout := arg
+		if layout == "" {
+			layout = "20060102150405"
+		}
+		return func(b *strings.Builder, _ *Context) {
+			b.WriteString(time.Now().Format(layout))
+		}, nil
+
+	case "choice":
+		items := strings.Split(arg, "|")
+		if arg == "" {
+			return nil, errors.New("choice needs at least one item")
+		}
+		return func(b *strings.Builder, _ *Context) {
+			b.WriteString(items[rand.Intn(len(items))])
+		}, nil
+
+	case "account":
+		return func(b *strings.Builder, ctx *Context) {
+			b.WriteString(ctx.Account)
+		}, nil
+
+	case "worker":
+		return func(b *strings.Builder, ctx *Context) {
+			b.WriteString(ctx.Worker)
+		}, nil
+
+	case "mo_phone":
+		return func(b *strings.Builder, ctx *Context) {
+			b.WriteString(ctx.MoPhone)
+		}, nil
+
+	case "mo_content":
+		return func(b *strings.Builder, ctx *Context) {
+			b.WriteString(ctx.MoContent)
+		}, nil
+
+	case "pad":
+		args := strings.SplitN(arg, ":", 3)
+		if len(args) < 2 {
+			return nil, errors.New("pad needs min and max length: " + arg)
+		}
+		min, minErr := strconv.Atoi(args[0])
+		max, maxErr := strconv.Atoi(args[1])
+		if minErr != nil || maxErr != nil || min < 0 || max < min {
+			return nil, errors.New("invalid pad length: " + arg)
+		}
+		filler := "x"
+		if len(args) == 3 && args[2] != "" {
+			filler = args[2]
+		}
+		return func(b *strings.Builder, _ *Context) {
+			n := min + rand.Intn(max-min+1)
+			b.WriteString(strings.Repeat(filler, n))
+		}, nil
+	}
+
+	return nil, errors.New("unknown variable: " + name)
+}
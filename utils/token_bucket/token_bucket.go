@@ -0,0 +1,63 @@
+package token_bucket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 令牌桶限速，并发安全
+type TokenBucket struct {
+	lock   sync.Mutex
+	rate   float64 // 每秒生成的令牌数
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time
+}
+
+// rate 为每秒令牌数，burst 为桶容量，为 0 时取 1
+func New(rate, burst uint) *TokenBucket {
+	if burst == 0 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 预留一个令牌，返回需要等待的时间
+func (b *TokenBucket) reserve() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// 阻塞直到取得一个令牌，ctx 结束时返回错误
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	wait := b.reserve()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}